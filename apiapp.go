@@ -573,6 +573,7 @@ func createapi(cmd *Command, args []string) int {
 	}
 
 	ColorLog("[INFO] Creating API...\n")
+	data := &AppTemplateData{Appname: path.Base(args[0]), PkgPath: packpath}
 	
 	// func MkdirAll(path string, perm FileMode) error
 	// MkdirAll使用指定的权限和名称创建一个目录，包括任何必要的上级目录，并返回nil，否则返回错误。
@@ -604,24 +605,27 @@ func createapi(cmd *Command, args []string) int {
 		// Base函数返回路径的最后一个元素。
 		// 在提取元素前会求掉末尾的路径分隔符。
 		// 如果路径是""，会返回"."；如果路径是只有一个斜杆构成，会返回单个路径分隔符。
-		strings.Replace(apiconf, "{{.Appname}}", path.Base(args[0]), -1))
+		templateOr("api/conf/app.conf", data, strings.Replace(apiconf, "{{.Appname}}", path.Base(args[0]), -1)))
 
 	if conn != "" {
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "main.go"), "\x1b[0m")
 		maingoContent := strings.Replace(apiMainconngo, "{{.Appname}}", packpath, -1)
 		maingoContent = strings.Replace(maingoContent, "{{.DriverName}}", string(driver), -1)
+		data.Driver = string(driver)
+		data.Conn = conn.String()
 		if driver == "mysql" {
-			maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", `_ "github.com/go-sql-driver/mysql"`, -1)
+			data.DriverPkg = `_ "github.com/go-sql-driver/mysql"`
 		} else if driver == "postgres" {
-			maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", `_ "github.com/lib/pq"`, -1)
+			data.DriverPkg = `_ "github.com/lib/pq"`
 		}
+		maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", data.DriverPkg, -1)
 		WriteToFile(path.Join(apppath, "main.go"),
-			strings.Replace(
+			templateOr("api/main.go", data, strings.Replace(
 				maingoContent,
 				"{{.conn}}",
 				conn.String(),
 				-1,
-			),
+			)),
 		)
 		ColorLog("[INFO] Using '%s' as 'driver'\n", driver)
 		ColorLog("[INFO] Using '%s' as 'conn'\n", conn)
@@ -635,29 +639,29 @@ func createapi(cmd *Command, args []string) int {
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "controllers", "object.go"), "\x1b[0m")
 		WriteToFile(path.Join(apppath, "controllers", "object.go"),
-			strings.Replace(apiControllers, "{{.Appname}}", packpath, -1))
+			templateOr("api/controllers/object.go", data, strings.Replace(apiControllers, "{{.Appname}}", packpath, -1)))
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "controllers", "user.go"), "\x1b[0m")
 		WriteToFile(path.Join(apppath, "controllers", "user.go"),
-			strings.Replace(apiControllers2, "{{.Appname}}", packpath, -1))
+			templateOr("api/controllers/user.go", data, strings.Replace(apiControllers2, "{{.Appname}}", packpath, -1)))
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "tests", "default_test.go"), "\x1b[0m")
 		WriteToFile(path.Join(apppath, "tests", "default_test.go"),
-			strings.Replace(apiTests, "{{.Appname}}", packpath, -1))
+			templateOr("api/tests/default_test.go", data, strings.Replace(apiTests, "{{.Appname}}", packpath, -1)))
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "routers", "router.go"), "\x1b[0m")
 		WriteToFile(path.Join(apppath, "routers", "router.go"),
-			strings.Replace(apirouter, "{{.Appname}}", packpath, -1))
+			templateOr("api/routers/router.go", data, strings.Replace(apirouter, "{{.Appname}}", packpath, -1)))
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "models", "object.go"), "\x1b[0m")
-		WriteToFile(path.Join(apppath, "models", "object.go"), apiModels)
+		WriteToFile(path.Join(apppath, "models", "object.go"), templateOr("api/models/object.go", data, apiModels))
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "models", "user.go"), "\x1b[0m")
-		WriteToFile(path.Join(apppath, "models", "user.go"), apiModels2)
+		WriteToFile(path.Join(apppath, "models", "user.go"), templateOr("api/models/user.go", data, apiModels2))
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "main.go"), "\x1b[0m")
 		WriteToFile(path.Join(apppath, "main.go"),
-			strings.Replace(apiMaingo, "{{.Appname}}", packpath, -1))
+			templateOr("api/main.go", data, strings.Replace(apiMaingo, "{{.Appname}}", packpath, -1)))
 	}
 	ColorLog("[SUCC] New API successfully created!\n")
 	return 0
@@ -17,17 +17,23 @@ package main
 import (
 	"bytes"	// 操作[]byte的常用函数。本包的函数和strings包的函数相当类似。
 	"compress/gzip"	// 实现了gzip格式压缩文件的读写
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"	// 格式化i/o
 	"io"	// I/O基本接口
 	"os"	// 系统函数
 	"path"	// 对斜杠分隔的路径的实用操作函数
+	"io/ioutil"
+	"os/exec"
 	"path/filepath"	// 文件路径函数
+	"regexp"
 	"runtime"	// 环境操作
+	"strconv"
 	"strings"	// 字符串操作
 )
 
 var cmdBale = &Command{
-	UsageLine: "bale",
+	UsageLine: "bale [-mode=embed|bytes] [-extract=true]",
 	Short:     "packs non-Go files to Go source files",
 	Long: `
 Bale command compress all the static files in to a single binary file.
@@ -38,11 +44,37 @@ and views when publishing a project.
 auto-generate unpack function to main package then run it during the runtime.
 This is mainly used for zealots who are requiring 100% Go code.
 
+-mode    embed: bale.go embeds the files with //go:embed. The static files are
+                served from them, and so are the templates when the views
+                are baled. BaleFS() and BaleHTTP() return them as an fs.FS
+                and an http.FileSystem.
+         bytes: each file is gzipped to a Go file of the bale package, and
+                bale.go writes the files to disk at startup. A file is only
+                written when missing, or when it is the one of an older bale:
+                .bale.sum records the SHA-256 of the files written, and the
+                files edited since are left alone.
+         The default is embed with Go 1.16 or later, bytes otherwise.
+
+-extract with -mode=bytes, false serves the static files and templates from
+         memory instead of writing them to disk.
+
+With -mode=bytes, the app can call BaleList() for the names of the files,
+BaleVerify() for those missing or changed on disk, BaleRestore(names...) to
+write them back, and BaleOpen(name) for the content of one, checked against
+its SHA-256.
+
 `,
 }
 
+var (
+	baleMode    string
+	baleExtract bool
+)
+
 func init() {
 	cmdBale.Run = runBale
+	cmdBale.Flag.StringVar(&baleMode, "mode", "", "embed or bytes. default is embed with Go 1.16 or later")
+	cmdBale.Flag.BoolVar(&baleExtract, "extract", true, "with -mode=bytes, write the files to disk at startup")
 }
 
 func runBale(cmd *Command, args []string) int {
@@ -58,6 +90,22 @@ func runBale(cmd *Command, args []string) int {
 	// 它会尝试删除所有东西，除非遇到错误并返回。
 	// 如果path指定的对象不存在，RemoveAll会返回nil而不返回错误。
 	os.RemoveAll("bale")
+
+	switch baleMode {
+	case "":
+		baleMode = "bytes"
+		if canEmbed() {
+			baleMode = "embed"
+		}
+	case "embed", "bytes":
+	default:
+		ColorLog("[ERRO] Unknown bale mode '%s'\n", baleMode)
+		ColorLog("[HINT] Use -mode=embed or -mode=bytes\n")
+		os.Exit(2)
+	}
+	if baleMode == "embed" {
+		return baleEmbed()
+	}
 	os.Mkdir("bale", os.ModePerm)
 
 	// Pack and compress data.
@@ -89,9 +137,7 @@ func runBale(cmd *Command, args []string) int {
 	
 	// func Join(a []string, sep string) string
 	// 将一系列字符串连接为一个字符串，之间用sep来分隔。
-	buf.WriteString(fmt.Sprintf(BaleHeader, conf.Bale.Import,
-		strings.Join(resFiles, "\",\n\t\t\""),
-		strings.Join(resFiles, ",\n\t\tbale.R")))
+	buf.WriteString(bytesSource(conf.Bale.Import, baleExtract))
 	// func Create(name string) (file *File, err error)
 	// Create采用模式0666（任何人都可读写，不可执行）创建一个名为name的文件，如果文件已存在会截断它（为空文件）。
 	// 如果成功，返回的文件对象可用于I/O；对应的文件描述符具有O_RDWR模式。
@@ -119,60 +165,426 @@ func runBale(cmd *Command, args []string) int {
 }
 
 const (
-	BaleHeader = `package main
+	BaleHeader = `// Code generated by bee bale. DO NOT EDIT.
 
-import(
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
 	"os"
-	"strings"
 	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
 
-	"%s"
+	"{{import}}"
 )
 
-func isExist(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil || os.IsExist(err)
+// baleExtract tells if the baled files are written to disk at startup,
+// otherwise they are served from memory.
+const baleExtract = {{extract}}
+
+// baleManifest records the SHA-256 of the files written to disk, which
+// tells the files edited since from the files of an older bale.
+const baleManifest = ".bale.sum"
+
+var baleFiles = []struct {
+	name string
+	hash string // SHA-256 of the content
+	data func() []byte
+}{
+	{{files}}
 }
 
 func init() {
-	files := []string{
-		"%s",
+	if !baleExtract {
+		if _, err := BaleHTTP().Open(beego.BConfig.WebConfig.ViewsPath); err == nil {
+			beego.SetTemplateFSFunc(BaleHTTP)
+		}
+		beego.InsertFilter("/*", beego.BeforeStatic, baleStatic)
+		return
+	}
+	if err := baleExtractFiles(); err != nil {
+		log.Printf("bale: %v", err)
+	}
+}
+
+// baleExtractFiles writes the baled files missing on disk, and those of an
+// older bale not edited since. The files edited are left alone.
+func baleExtractFiles() error {
+	sums := baleReadManifest()
+	for _, f := range baleFiles {
+		hash, err := baleFileHash(f.name)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		case hash == f.hash:
+			sums[f.name] = hash
+			continue
+		case hash != sums[f.name]:
+			log.Printf("bale: %s was edited, not overwriting it", f.name)
+			continue
+		}
+		if err := baleWrite(f.name); err != nil {
+			return err
+		}
+		sums[f.name] = f.hash
+	}
+	return baleWriteManifest(sums)
+}
+
+// BaleList returns the names of the baled files.
+func BaleList() []string {
+	names := make([]string, len(baleFiles))
+	for i, f := range baleFiles {
+		names[i] = f.name
+	}
+	return names
+}
+
+// BaleVerify returns the baled files missing on disk or whose content on
+// disk is not the baled one.
+func BaleVerify() ([]string, error) {
+	var changed []string
+	for _, f := range baleFiles {
+		hash, err := baleFileHash(f.name)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if hash != f.hash {
+			changed = append(changed, f.name)
+		}
 	}
+	return changed, nil
+}
+
+// BaleRestore writes the baled files names, all of them if none, to disk,
+// overwriting the files edited.
+func BaleRestore(names ...string) error {
+	if len(names) == 0 {
+		names = BaleList()
+	}
+	sums := baleReadManifest()
+	for _, name := range names {
+		if err := baleWrite(name); err != nil {
+			return err
+		}
+		sums[name] = baleFind(name).hash
+	}
+	return baleWriteManifest(sums)
+}
 
-	funcs := []func() []byte{
-		bale.R%s,
+// BaleOpen returns the content of the baled file name, after checking
+// its SHA-256.
+func BaleOpen(name string) ([]byte, error) {
+	f := baleFind(name)
+	if f == nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	b := f.data()
+	if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != f.hash {
+		return nil, fmt.Errorf("bale: %s is corrupted", name)
 	}
+	return b, nil
+}
 
-	for i, f := range funcs {
-		fp := getFilePath(files[i])
-		if !isExist(fp) {
-			saveFile(fp, f())
+func baleFind(name string) *struct {
+	name string
+	hash string
+	data func() []byte
+} {
+	for i := range baleFiles {
+		if baleFiles[i].name == name {
+			return &baleFiles[i]
 		}
 	}
+	return nil
 }
 
-func getFilePath(name string) string {
-	name = strings.Replace(name, "_4_", "/", -1)
-	name = strings.Replace(name, "_3_", " ", -1)
-	name = strings.Replace(name, "_2_", "-", -1)
-	name = strings.Replace(name, "_1_", ".", -1)
-	name = strings.Replace(name, "_0_", "_", -1)
-	return name
+func baleWrite(name string) error {
+	b, err := BaleOpen(name)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(path.Dir(name), os.ModePerm)
+	return ioutil.WriteFile(name, b, 0644)
 }
 
-func saveFile(filePath string, b []byte) (int, error) {
-	os.MkdirAll(path.Dir(filePath), os.ModePerm)
-	fw, err := os.Create(filePath)
+func baleFileHash(name string) (string, error) {
+	f, err := os.Open(name)
 	if err != nil {
-		return 0, err
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// baleReadManifest reads the manifest, in the format of sha256sum.
+func baleReadManifest() map[string]string {
+	sums := make(map[string]string)
+	f, err := os.Open(baleManifest)
+	if err != nil {
+		return sums
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if parts := strings.SplitN(s.Text(), "  ", 2); len(parts) == 2 {
+			sums[parts[1]] = parts[0]
+		}
+	}
+	return sums
+}
+
+func baleWriteManifest(sums map[string]string) error {
+	var names []string
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", sums[name], name)
+	}
+	return ioutil.WriteFile(baleManifest, buf.Bytes(), 0644)
+}
+
+// BaleHTTP returns the baled files as an http.FileSystem.
+func BaleHTTP() http.FileSystem {
+	return baleFS{}
+}
+
+type baleFS struct{}
+
+func (baleFS) Open(name string) (http.File, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if b, err := BaleOpen(name); err == nil {
+		return &baleFile{Reader: bytes.NewReader(b), info: baleInfo{path.Base(name), int64(len(b)), false}}, nil
+	} else if baleFind(name) != nil {
+		return nil, err
+	}
+	// a directory holds the files and directories under it
+	prefix := name + "/"
+	if name == "" {
+		prefix = ""
+	}
+	seen := make(map[string]bool)
+	var entries []os.FileInfo
+	for _, f := range baleFiles {
+		if !strings.HasPrefix(f.name, prefix) {
+			continue
+		}
+		rest := f.name[len(prefix):]
+		if i := strings.Index(rest, "/"); i >= 0 {
+			if !seen[rest[:i]] {
+				seen[rest[:i]] = true
+				entries = append(entries, baleInfo{rest[:i], 0, true})
+			}
+		} else {
+			entries = append(entries, baleInfo{rest, 0, false})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &baleFile{Reader: bytes.NewReader(nil), info: baleInfo{path.Base(name), 0, true}, entries: entries}, nil
+}
+
+type baleFile struct {
+	*bytes.Reader
+	info    baleInfo
+	entries []os.FileInfo
+}
+
+func (f *baleFile) Close() error               { return nil }
+func (f *baleFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+func (f *baleFile) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.entries) {
+		count = len(f.entries)
+	}
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+type baleInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (i baleInfo) Name() string       { return i.name }
+func (i baleInfo) Size() int64        { return i.size }
+func (i baleInfo) ModTime() time.Time { return time.Time{} }
+func (i baleInfo) IsDir() bool        { return i.isDir }
+func (i baleInfo) Sys() interface{}   { return nil }
+
+func (i baleInfo) Mode() os.FileMode {
+	if i.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+{{static}}`
+
+	// BaleStatic is the filter of bale.go serving the static files from
+	// BaleHTTP.
+	BaleStatic = `
+// baleStatic serves the files of the static directories from the baled
+// files, before beego looks for them on disk.
+func baleStatic(ctx *context.Context) {
+	if ctx.Request.Method != "GET" && ctx.Request.Method != "HEAD" {
+		return
+	}
+	urlPath := ctx.Request.URL.Path
+	for prefix, dir := range beego.BConfig.WebConfig.StaticDir {
+		rest := strings.TrimPrefix(urlPath, prefix)
+		if rest == urlPath || (rest != "" && rest[0] != '/' && !strings.HasSuffix(prefix, "/")) {
+			continue
+		}
+		f, err := BaleHTTP().Open(path.Join(dir, path.Clean("/"+rest)))
+		if err != nil {
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			f.Close()
+			continue
+		}
+		http.ServeContent(ctx.ResponseWriter, ctx.Request, fi.Name(), fi.ModTime(), f)
+		f.Close()
+		return
 	}
-	defer fw.Close()
-	return fw.Write(b)
 }
 `
 )
 
-var resFiles = make([]string, 0, 10)
+// bytesSource returns the source of bale.go calling the R functions of
+// the package imp.
+func bytesSource(imp string, extract bool) string {
+	var entries []string
+	for i, f := range resFiles {
+		entries = append(entries, fmt.Sprintf("{%q, %q, bale.R%s},", resNames[i], resHashes[i], f))
+	}
+	src := strings.Replace(BaleHeader, "{{import}}", imp, 1)
+	src = strings.Replace(src, "{{extract}}", strconv.FormatBool(extract), 1)
+	src = strings.Replace(src, "{{files}}", strings.Join(entries, "\n\t"), 1)
+	return strings.Replace(src, "{{static}}", BaleStatic, 1)
+}
+
+// canEmbed tells if the go command and the go.mod of the app, if any, are
+// of Go 1.16 or later, which has //go:embed. The go command of older
+// versions has no GOVERSION.
+func canEmbed() bool {
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil || !goVersionAtLeast(strings.TrimSpace(string(out)), 16) {
+		return false
+	}
+	if data, err := ioutil.ReadFile("go.mod"); err == nil {
+		m := regexp.MustCompile(`(?m)^go\s+(\S+)`).FindSubmatch(data)
+		if m != nil && !goVersionAtLeast(string(m[1]), 16) {
+			return false
+		}
+	}
+	return true
+}
+
+// goVersionAtLeast tells if the Go version v, e.g. go1.16.3 or 1.21, is
+// 1.minor or later.
+func goVersionAtLeast(v string, minor int) bool {
+	parts := strings.SplitN(strings.TrimPrefix(v, "go"), ".", 3)
+	if len(parts) < 2 || parts[0] != "1" {
+		return false
+	}
+	// e.g. 1.21rc1
+	n := strings.IndexFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' })
+	if n >= 0 {
+		parts[1] = parts[1][:n]
+	}
+	m, err := strconv.Atoi(parts[1])
+	return err == nil && m >= minor
+}
+
+// baleEmbed writes bale.go embedding the files of the bale directories.
+func baleEmbed() int {
+	var files []string
+	for _, p := range conf.Bale.Dirs {
+		dir := filepath.ToSlash(filepath.Clean(p))
+		if !isExist(p) || filepath.IsAbs(p) || dir == ".." || strings.HasPrefix(dir, "../") {
+			ColorLog("[WARN] Skipped directory( %s )\n", p)
+			continue
+		}
+		ColorLog("[INFO] Packaging directory( %s )\n", p)
+		filepath.Walk(p, func(fpath string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filterSuffix(fpath) {
+				return nil
+			}
+			name := filepath.ToSlash(filepath.Clean(fpath))
+			if strings.ContainsAny(name, "\"*<>?`'|:\\") {
+				ColorLog("[WARN] Skipped file( %s ): its name can not be embedded\n", fpath)
+				return nil
+			}
+			files = append(files, name)
+			return nil
+		})
+	}
+	if len(files) == 0 {
+		ColorLog("[ERRO] No files to bale\n")
+		ColorLog("[HINT] Set \"dirs\" of \"bale\" in bee.json\n")
+		os.Exit(2)
+	}
+
+	if err := ioutil.WriteFile("bale.go", []byte(embedSource(files)), 0644); err != nil {
+		ColorLog("[ERRO] Fail to write data[ %s ]\n", err)
+		os.Exit(2)
+	}
+	ColorLog("[SUCC] Baled resources successfully!\n")
+	return 0
+}
+
+// embedSource returns the source of bale.go embedding files.
+func embedSource(files []string) string {
+	var lines []string
+	for _, f := range files {
+		if strings.ContainsAny(f, " \t") {
+			f = strconv.Quote(f)
+		}
+		lines = append(lines, "//go:embed "+f)
+	}
+	src := strings.Replace(BaleEmbed, "{{embed}}", strings.Join(lines, "\n"), 1)
+	return strings.Replace(src, "{{static}}", BaleStatic, 1)
+}
+
+var (
+	resFiles  = make([]string, 0, 10) // names of the R functions
+	resNames  = make([]string, 0, 10) // paths of the files
+	resHashes = make([]string, 0, 10) // SHA-256 of the files
+)
 // type FileInfo interface {
 //     Name() string       // 文件的名字（不含扩展名）
 //     Size() int64        // 普通文件返回值表示其大小；其他文件的返回值含义各系统不同
@@ -193,6 +605,8 @@ func walkFn(resPath string, info os.FileInfo, err error) error {
 		ColorLog("[ERRO] Fail to read file[ %s ]\n", err)
 		os.Exit(2)
 	}
+	defer fr.Close()
+	name := filepath.ToSlash(resPath)
 
 	// Convert path.
 	resPath = strings.Replace(resPath, "_", "_0_", -1)
@@ -254,7 +668,8 @@ func walkFn(resPath string, info os.FileInfo, err error) error {
 	// 对成功的调用，返回值err为nil而非EOF，因为Copy定义为从src读取直到EOF，它不会将读取到EOF视为应报告的错误。
 	// 如果src实现了WriterTo接口，本函数会调用src.WriteTo(dst)进行拷贝；
 	// 否则如果dst实现了ReaderFrom接口，本函数会调用dst.ReadFrom(src)进行拷贝。
-	io.Copy(gz, fr)
+	h := sha256.New()
+	io.Copy(gz, io.TeeReader(fr, h))
 	// func (z *Writer) Close() error
 	// 调用Close会关闭z，但不会关闭下层io.Writer接口。
 	gz.Close()
@@ -268,6 +683,8 @@ func walkFn(resPath string, info os.FileInfo, err error) error {
 	fmt.Fprint(fw, Footer)
 
 	resFiles = append(resFiles, resPath)
+	resNames = append(resNames, name)
+	resHashes = append(resHashes, hex.EncodeToString(h.Sum(nil)))
 	return nil
 }
 
@@ -308,6 +725,44 @@ func R%s() []byte {
 }`
 )
 
+// BaleEmbed is bale.go with -mode=embed.
+const BaleEmbed = `// Code generated by bee bale. DO NOT EDIT.
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+)
+
+{{embed}}
+var baleFiles embed.FS
+
+// BaleFS returns the baled files, e.g. fs.ReadFile(BaleFS(), "static/js/app.js").
+func BaleFS() fs.FS {
+	return baleFiles
+}
+
+// BaleHTTP returns the baled files as an http.FileSystem.
+func BaleHTTP() http.FileSystem {
+	return http.FS(baleFiles)
+}
+
+func init() {
+	// The templates are read from the baled files when the views are baled.
+	if _, err := fs.Stat(baleFiles, path.Clean(beego.BConfig.WebConfig.ViewsPath)); err == nil {
+		beego.SetTemplateFSFunc(BaleHTTP)
+	}
+	beego.InsertFilter("/*", beego.BeforeStatic, baleStatic)
+}
+{{static}}`
+
 var newline = []byte{'\n'}
 
 type ByteWriter struct {
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoVersionAtLeast(t *testing.T) {
+	cases := []struct {
+		v    string
+		want bool
+	}{
+		{"go1.16", true},
+		{"go1.21.3", true},
+		{"1.16", true},
+		{"go1.22rc1", true},
+		{"go1.15.15", false},
+		{"1.12", false},
+		{"", false},
+		{"devel +abc", false},
+	}
+	for _, c := range cases {
+		if got := goVersionAtLeast(c.v, 16); got != c.want {
+			t.Errorf("%q: got %v, want %v", c.v, got, c.want)
+		}
+	}
+}
+
+func TestEmbedSource(t *testing.T) {
+	src := embedSource([]string{"static/js/app.js", "static/my css/b.css"})
+	for _, want := range []string{
+		"//go:embed static/js/app.js\n",
+		"//go:embed \"static/my css/b.css\"\nvar baleFiles embed.FS",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q in:\n%s", want, src)
+		}
+	}
+}
+
+func TestBytesSource(t *testing.T) {
+	resFiles = []string{"static_4_app_1_css"}
+	resNames = []string{"static/app.css"}
+	resHashes = []string{"2708d73bf31c36cdfa1aa466551ed101017280fa546caba4473cfef6e92a93b5"}
+	defer func() { resFiles, resNames, resHashes = resFiles[:0], resNames[:0], resHashes[:0] }()
+
+	src := bytesSource("github.com/user/app/bale", false)
+	if _, err := parser.ParseFile(token.NewFileSet(), "bale.go", src, 0); err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"const baleExtract = false\n",
+		`{"static/app.css", "2708d73bf31c36cdfa1aa466551ed101017280fa546caba4473cfef6e92a93b5", bale.Rstatic_4_app_1_css},`,
+		"func baleStatic(ctx *context.Context) {",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+// TestBytesSourceViews runs the bale.go of -mode=bytes -extract=false
+// against a stub of beego: the views are served from memory, none is
+// written to disk.
+func TestBytesSourceViews(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is needed")
+	}
+	resFiles = []string{"views_4_index_1_tpl"}
+	resNames = []string{"views/index.tpl"}
+	resHashes = []string{"5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"}
+	defer func() { resFiles, resNames, resHashes = resFiles[:0], resNames[:0], resHashes[:0] }()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod":  "module app\n\ngo 1.16\n\nrequire github.com/astaxie/beego v1.12.3\n\nreplace github.com/astaxie/beego => ./beego\n",
+		"bale.go": bytesSource("app/bale", false),
+		"bale/views.go": `package bale
+
+func Rviews_4_index_1_tpl() []byte { return []byte("hello\n") }
+`,
+		"main.go": `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/astaxie/beego"
+)
+
+func main() {
+	if beego.TemplateFS == nil {
+		fmt.Println("the views are not served from memory")
+		return
+	}
+	f, err := beego.TemplateFS().Open("views/index.tpl")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	b, _ := ioutil.ReadAll(f)
+	fmt.Print(string(b))
+	if _, err := os.Stat("views"); err == nil {
+		fmt.Println("the views were extracted")
+	}
+}
+`,
+		"beego/go.mod": "module github.com/astaxie/beego\n\ngo 1.16\n",
+		"beego/beego.go": `package beego
+
+import (
+	"net/http"
+
+	"github.com/astaxie/beego/context"
+)
+
+var BConfig = struct {
+	WebConfig struct {
+		ViewsPath string
+		StaticDir map[string]string
+	}
+}{}
+
+var TemplateFS func() http.FileSystem
+
+func init() {
+	BConfig.WebConfig.ViewsPath = "views"
+}
+
+func SetTemplateFSFunc(f func() http.FileSystem) { TemplateFS = f }
+
+type FilterFunc func(*context.Context)
+
+const BeforeStatic = 1
+
+func InsertFilter(pattern string, pos int, filter FilterFunc, params ...bool) {}
+`,
+		"beego/context/context.go": `package context
+
+import "net/http"
+
+type Context struct {
+	Request        *http.Request
+	ResponseWriter http.ResponseWriter
+}
+`,
+	} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if string(out) != "hello\n" {
+		t.Errorf("got %q, want the baled views/index.tpl", out)
+	}
+}
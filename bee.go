@@ -102,6 +102,9 @@ var commands = []*Command{
 	//cmdRundocs,
 	cmdMigrate, // ./migrate.go
 	cmdFix, // ./fix.go
+	cmdDockerize, // ./dockerize.go
+	cmdDeploy, // ./deploy.go
+	cmdConfig, // ./config.go
 }
 
 func main() {
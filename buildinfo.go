@@ -0,0 +1,125 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// buildInfo is what bee run and bee pack tell the app about its build,
+// through the variables Version, Commit, BuildTime and GoVersion of the
+// package "package" of "build_info" in bee.json, main by default:
+//
+//	var (
+//		Version   string
+//		Commit    string
+//		BuildTime string
+//		GoVersion string
+//	)
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	GOOS      string `json:"goos,omitempty"`
+	GOARCH    string `json:"goarch,omitempty"`
+}
+
+// readBuildInfo returns the build information of the app at apppath: its
+// last git tag and commit, and the version of the go command.
+func readBuildInfo(apppath string, buildTime time.Time) *buildInfo {
+	bi := &buildInfo{
+		Version:   gitOutput(apppath, "describe", "--tags", "--dirty"),
+		Commit:    gitOutput(apppath, "rev-parse", "--short", "HEAD"),
+		BuildTime: buildTime.UTC().Format(time.RFC3339),
+		GoVersion: runtime.Version(),
+	}
+	if bi.Version == "" {
+		bi.Version = "dev"
+	}
+	if bi.Commit == "" {
+		bi.Commit = "unknown"
+	}
+	if out, err := exec.Command("go", "env", "GOVERSION").Output(); err == nil && len(strings.TrimSpace(string(out))) > 0 {
+		bi.GoVersion = strings.TrimSpace(string(out))
+	}
+	return bi
+}
+
+func gitOutput(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ldflags returns the -X flags of the linker setting the variables of
+// the package pkg.
+func (bi *buildInfo) ldflags(pkg string) string {
+	if pkg == "" {
+		pkg = "main"
+	}
+	vars := []struct{ name, value string }{
+		{"Version", bi.Version},
+		{"Commit", bi.Commit},
+		{"BuildTime", bi.BuildTime},
+		{"GoVersion", bi.GoVersion},
+	}
+	var flags []string
+	for _, v := range vars {
+		flags = append(flags, "-X "+pkg+"."+v.name+"="+v.value)
+	}
+	return strings.Join(flags, " ")
+}
+
+// withLdflags returns the arguments of go build args with flags added to
+// their -ldflags.
+func withLdflags(args []string, flags string) []string {
+	for i, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "-ldflags="):
+			args[i] = arg + " " + flags
+			return args
+		case arg == "-ldflags" && i+1 < len(args):
+			args[i+1] += " " + flags
+			return args
+		}
+	}
+	return append(args, "-ldflags", flags)
+}
+
+// writeManifest writes the VERSION and build.json files of the build to
+// the directory dir.
+func (bi *buildInfo) writeManifest(dir, goos, goarch string) error {
+	m := *bi
+	m.GOOS, m.GOARCH = goos, goarch
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "build.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "VERSION"), []byte(bi.Version+"\n"), 0644)
+}
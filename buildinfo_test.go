@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithLdflags(t *testing.T) {
+	cases := []struct {
+		name       string
+		args, want []string
+	}{
+		{
+			"-ldflags=",
+			[]string{"build", "-ldflags=-s -w", "-o", "app"},
+			[]string{"build", "-ldflags=-s -w -X main.Version=v1", "-o", "app"},
+		},
+		{
+			"-ldflags value",
+			[]string{"build", "-ldflags", "-s -w", "-o", "app"},
+			[]string{"build", "-ldflags", "-s -w -X main.Version=v1", "-o", "app"},
+		},
+		{
+			"no -ldflags",
+			[]string{"build", "-o", "app"},
+			[]string{"build", "-o", "app", "-ldflags", "-X main.Version=v1"},
+		},
+	}
+	for _, c := range cases {
+		if got := withLdflags(c.args, "-X main.Version=v1"); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestBuildInfoLdflags(t *testing.T) {
+	bi := &buildInfo{Version: "v1.2.0", Commit: "abc1234", BuildTime: "2020-01-02T03:04:05Z", GoVersion: "go1.22.0"}
+	for pkg, want := range map[string]string{
+		"":             "-X main.Version=v1.2.0 -X main.Commit=abc1234 -X main.BuildTime=2020-01-02T03:04:05Z -X main.GoVersion=go1.22.0",
+		"blog/version": "-X blog/version.Version=v1.2.0 -X blog/version.Commit=abc1234 -X blog/version.BuildTime=2020-01-02T03:04:05Z -X blog/version.GoVersion=go1.22.0",
+	} {
+		if got := bi.ldflags(pkg); got != want {
+			t.Errorf("package %q: got %s, want %s", pkg, got, want)
+		}
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	bi := &buildInfo{Version: "v1.2.0", Commit: "abc1234", BuildTime: "2020-01-02T03:04:05Z", GoVersion: "go1.22.0"}
+	dir := t.TempDir()
+	if err := bi.writeManifest(dir, "linux", "arm64"); err != nil {
+		t.Fatal(err)
+	}
+
+	version, _ := ioutil.ReadFile(filepath.Join(dir, "VERSION"))
+	if string(version) != "v1.2.0\n" {
+		t.Errorf("VERSION: got %q", version)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "build.json"))
+	var got buildInfo
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := *bi
+	want.GOOS, want.GOARCH = "linux", "arm64"
+	if got != want {
+		t.Errorf("build.json: got %+v, want %+v", got, want)
+	}
+	if !strings.Contains(string(data), `"build_time": "2020-01-02T03:04:05Z"`) {
+		t.Errorf("build.json: %s", data)
+	}
+	if bi.GOOS != "" {
+		t.Error("writeManifest changed the build info")
+	}
+}
@@ -72,6 +72,44 @@ var conf struct {
 		Driver string
 		Conn   string
 	}
+	// Table and column filters for "bee generate appcode".
+	Appcode struct {
+		Tables         []string
+		Exclude        []string
+		Prefix         []string
+		ExcludeColumns []string `json:"exclude_columns" yaml:"exclude_columns"`
+		Transport      string
+	}
+	// Metadata of the deb and rpm packages of "bee pack".
+	Package struct {
+		Name        string
+		Version     string
+		Release     string
+		Maintainer  string
+		Description string
+		Homepage    string
+		License     string
+		Depends     []string
+		User        string
+	}
+	// Package of the Version, Commit, BuildTime and GoVersion variables
+	// set by "bee run" and "bee pack", main by default.
+	BuildInfo struct {
+		Package string
+		Disable bool
+	} `json:"build_info" yaml:"build_info"`
+	// Servers of "bee deploy" and the layout of the app on them.
+	Deploy struct {
+		Hosts      []string // [user@]host[:port]
+		User       string
+		Key        string // private key file
+		KnownHosts string `json:"known_hosts" yaml:"known_hosts"`
+		Path       string // directory of the releases and of the current symlink
+		Restart    string // command run in path/current after a switch
+		Keep       int    // releases kept, 5 by default
+		GOOS       string `json:"goos" yaml:"goos"`
+		GOARCH     string `json:"goarch" yaml:"goarch"`
+	}
 }
 
 // loadConfig loads customized configuration.
@@ -0,0 +1,491 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+var cmdConfig = &Command{
+	UsageLine: "config validate|show",
+	Short:     "validate and show the bee.json and Beefile of a project",
+	Long: `
+Config checks and explains the configuration of bee in the current directory,
+read from bee.json and then from Beefile, whose values win.
+
+    bee config validate    reports, with their line, the unknown keys, the
+                           values of the wrong type, the keys given twice,
+                           and the values bee.json and Beefile disagree on
+    bee config show        prints the configuration bee uses and where each
+                           value comes from: bee.json, Beefile or default
+`,
+}
+
+func init() {
+	cmdConfig.Run = runConfig
+}
+
+func runConfig(cmd *Command, args []string) int {
+	if len(args) != 1 || (args[0] != "validate" && args[0] != "show") {
+		ColorLog("[ERRO] Usage: bee config validate|show\n")
+		os.Exit(2)
+	}
+
+	var files []*confFile
+	for _, name := range []string{"bee.json", "Beefile"} {
+		data, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			ColorLog("[ERRO] %s\n", err)
+			os.Exit(2)
+		}
+		f, err := parseConfFile(name, data)
+		if err != nil {
+			ColorLog("[ERRO] %s\n", err)
+			os.Exit(2)
+		}
+		files = append(files, f)
+	}
+
+	if args[0] == "show" {
+		if err := loadConfig(); err != nil {
+			ColorLog("[ERRO] Fail to parse the configuration: %s\n", err)
+			ColorLog("[HINT] Run 'bee config validate' to find the errors\n")
+			os.Exit(2)
+		}
+		showConfig(os.Stdout, files)
+		return 0
+	}
+
+	if len(files) == 0 {
+		ColorLog("[INFO] No bee.json nor Beefile, bee uses its default configuration\n")
+		return 0
+	}
+	errs, warns := validateConfig(files)
+	for _, w := range warns {
+		ColorLog("[WARN] %s\n", w)
+	}
+	for _, e := range errs {
+		ColorLog("[ERRO] %s\n", e)
+	}
+	if len(errs) > 0 {
+		os.Exit(2)
+	}
+	ColorLog("[SUCC] The configuration is valid\n")
+	return 0
+}
+
+// confItem is a value of bee.json or Beefile.
+type confItem struct {
+	key    string
+	line   int
+	value  interface{} // nil, bool, string, int64, float64 or []interface{}
+	fields []*confItem // of an object
+	object bool
+}
+
+// confFile is bee.json or Beefile, parsed with the line of each key.
+type confFile struct {
+	name   string
+	yaml   bool
+	root   *confItem
+	values map[string]*confItem // leaves by the path of their field, e.g. deploy.hosts
+}
+
+// parseConfFile parses the bee.json or Beefile content data.
+func parseConfFile(name string, data []byte) (*confFile, error) {
+	f := &confFile{name: name, yaml: name == "Beefile", values: make(map[string]*confItem)}
+	var err error
+	if f.yaml {
+		f.root, err = parseYAMLConf(data)
+	} else {
+		f.root, err = parseJSONConf(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return f, nil
+}
+
+func parseJSONConf(data []byte) (*confItem, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	lineAt := func() int {
+		off := int(d.InputOffset())
+		for off < len(data) && strings.IndexByte(" \t\r\n,:", data[off]) >= 0 {
+			off++
+		}
+		return bytes.Count(data[:off], []byte("\n")) + 1
+	}
+
+	var parse func(line int) (*confItem, error)
+	parse = func(line int) (*confItem, error) {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		item := &confItem{line: line}
+		switch t := tok.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				item.object = true
+				for d.More() {
+					line := lineAt()
+					key, err := d.Token()
+					if err != nil {
+						return nil, err
+					}
+					field, err := parse(line)
+					if err != nil {
+						return nil, err
+					}
+					field.key = key.(string)
+					item.fields = append(item.fields, field)
+				}
+			case '[':
+				list := []interface{}{}
+				for d.More() {
+					elem, err := parse(lineAt())
+					if err != nil {
+						return nil, err
+					}
+					list = append(list, elem.value)
+				}
+				item.value = list
+			}
+			// the closing delimiter
+			if _, err := d.Token(); err != nil {
+				return nil, err
+			}
+		case json.Number:
+			if n, err := t.Int64(); err == nil {
+				item.value = n
+			} else {
+				item.value, _ = t.Float64()
+			}
+		default:
+			item.value = t
+		}
+		return item, nil
+	}
+
+	root, err := parse(lineAt())
+	if err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			return nil, fmt.Errorf("line %d: %v", bytes.Count(data[:se.Offset], []byte("\n"))+1, err)
+		}
+		return nil, err
+	}
+	if !root.object {
+		return nil, fmt.Errorf("line %d: the configuration must be an object", root.line)
+	}
+	return root, nil
+}
+
+var yamlKeyRe = regexp.MustCompile(`^(\s*)("[^"]*"|'[^']*'|[^\s#'"][^:#]*?)\s*:(\s|$)`)
+
+func parseYAMLConf(data []byte) (*confItem, error) {
+	var ms yaml.MapSlice
+	if err := yaml.Unmarshal(data, &ms); err != nil {
+		return nil, err
+	}
+
+	// The lines of the keys of block mappings, found by their indentation.
+	lines := make(map[string][]int)
+	type level struct {
+		indent int
+		key    string
+	}
+	var stack []level
+	for i, l := range strings.Split(string(data), "\n") {
+		m := yamlKeyRe.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		indent := len(m[1])
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, level{indent, strings.Trim(m[2], `"'`)})
+		var path []string
+		for _, s := range stack {
+			path = append(path, s.key)
+		}
+		p := strings.Join(path, ".")
+		lines[p] = append(lines[p], i+1)
+	}
+
+	var convert func(path string, v interface{}) *confItem
+	convert = func(path string, v interface{}) *confItem {
+		item := &confItem{}
+		// a key given twice has two lines
+		if l := lines[path]; len(l) > 0 {
+			item.line, lines[path] = l[0], l[1:]
+		}
+		switch t := v.(type) {
+		case yaml.MapSlice:
+			item.object = true
+			for _, kv := range t {
+				key := fmt.Sprint(kv.Key)
+				p := key
+				if path != "" {
+					p = path + "." + key
+				}
+				field := convert(p, kv.Value)
+				field.key = key
+				item.fields = append(item.fields, field)
+			}
+		case []interface{}:
+			list := []interface{}{}
+			for _, e := range t {
+				list = append(list, convert("", e).value)
+			}
+			item.value = list
+		case int:
+			item.value = int64(t)
+		case uint64:
+			item.value = float64(t)
+		default:
+			item.value = t
+		}
+		return item
+	}
+	root := convert("", ms)
+	root.line = 1
+	return root, nil
+}
+
+// confFieldName returns the key of the field f in bee.json, or in Beefile
+// if isYAML, as their decoders name it.
+func confFieldName(f reflect.StructField, isYAML bool) string {
+	tag := f.Tag.Get("json")
+	if isYAML {
+		tag = f.Tag.Get("yaml")
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	if isYAML {
+		return strings.ToLower(f.Name)
+	}
+	return f.Name
+}
+
+// confKey returns the key of the field f shown by bee config: its name in
+// bee.json, or else its name in Beefile.
+func confKey(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+// confField returns the field of the struct t the key decodes into: the
+// decoder of bee.json ignores the case, the one of Beefile does not.
+func confField(t reflect.Type, key string, isYAML bool) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := confFieldName(f, isYAML)
+		if name == key || (!isYAML && strings.EqualFold(name, key)) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// confTypeError returns what the value v should be to decode into the type
+// t, or "" when it does.
+func confTypeError(t reflect.Type, v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	ok := false
+	switch t.Kind() {
+	case reflect.Bool:
+		_, ok = v.(bool)
+	case reflect.String:
+		_, ok = v.(string)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, ok = v.(int64)
+	case reflect.Slice:
+		list, isList := v.([]interface{})
+		if !isList {
+			return "a list"
+		}
+		for _, e := range list {
+			if want := confTypeError(t.Elem(), e); want != "" {
+				// e.g. a string, a list of strings
+				return "a list of " + strings.SplitN(want, " ", 2)[1] + "s"
+			}
+		}
+		return ""
+	case reflect.Struct:
+		return "an object"
+	}
+	if ok {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	}
+	return "an integer"
+}
+
+// check checks the fields of the object item against the struct t, and
+// indexes the leaves by path. It returns the problems found.
+func (f *confFile) check(item *confItem, t reflect.Type, path string) []string {
+	var errs []string
+	seen := make(map[string]int)
+	for _, field := range item.fields {
+		sf, ok := confField(t, field.key, f.yaml)
+		name := field.key
+		if ok {
+			name = confKey(sf)
+		}
+		p := name
+		if path != "" {
+			p = path + "." + name
+		}
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s:%d: unknown key %q", f.name, field.line, p))
+			continue
+		}
+		if line, dup := seen[name]; dup {
+			errs = append(errs, fmt.Sprintf("%s:%d: %q is already set at line %d", f.name, field.line, p, line))
+		}
+		seen[name] = field.line
+
+		if sf.Type.Kind() == reflect.Struct {
+			if !field.object {
+				if field.value != nil {
+					errs = append(errs, fmt.Sprintf("%s:%d: %q must be an object", f.name, field.line, p))
+				}
+				continue
+			}
+			errs = append(errs, f.check(field, sf.Type, p)...)
+			continue
+		}
+		want := confTypeError(sf.Type, field.value)
+		if field.object {
+			want = confTypeError(sf.Type, struct{}{})
+		}
+		if want != "" {
+			errs = append(errs, fmt.Sprintf("%s:%d: %q must be %s, not %s", f.name, field.line, p, want, confValueString(field)))
+			continue
+		}
+		f.values[p] = field
+	}
+	return errs
+}
+
+func confValueString(item *confItem) string {
+	if item.object {
+		return "an object"
+	}
+	data, _ := json.Marshal(item.value)
+	return string(data)
+}
+
+// validateConfig checks the files against the fields of conf, then their
+// values against each other: Beefile is read after bee.json and wins.
+func validateConfig(files []*confFile) (errs, warns []string) {
+	t := reflect.TypeOf(conf)
+	for _, f := range files {
+		errs = append(errs, f.check(f.root, t, "")...)
+		if v, ok := f.values["version"]; ok && v.value != int64(ConfVer) {
+			warns = append(warns, fmt.Sprintf("%s:%d: version %v is not %d, the version of this bee", f.name, v.line, v.value, ConfVer))
+		}
+	}
+	if len(files) == 2 {
+		a, b := files[0], files[1]
+		for _, p := range sortedConfPaths(a.values) {
+			va, vb := a.values[p], b.values[p]
+			if vb != nil && confValueString(va) != confValueString(vb) {
+				warns = append(warns, fmt.Sprintf("%q is %s in %s:%d and %s in %s:%d, the value of %s is used",
+					p, confValueString(va), a.name, va.line, confValueString(vb), b.name, vb.line, b.name))
+			}
+		}
+	}
+	return errs, warns
+}
+
+func sortedConfPaths(values map[string]*confItem) []string {
+	var paths []string
+	for p := range values {
+		paths = append(paths, p)
+	}
+	// by line, which is the order of the file
+	sort.Slice(paths, func(i, j int) bool { return values[paths[i]].line < values[paths[j]].line })
+	return paths
+}
+
+// showConfig prints the fields of conf, with the file and line each value
+// comes from, or default.
+func showConfig(w io.Writer, files []*confFile) {
+	// only the valid values are sources
+	for _, f := range files {
+		f.check(f.root, reflect.TypeOf(conf), "")
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	var walk func(v reflect.Value, path string)
+	walk = func(v reflect.Value, path string) {
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			p := confKey(sf)
+			if path != "" {
+				p = path + "." + p
+			}
+			if sf.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), p)
+				continue
+			}
+			data, _ := json.Marshal(v.Field(i).Interface())
+			value := string(data)
+			source := "default"
+			// the last file setting the value, unless bee changed it since;
+			// null leaves the value as it is
+			for j := len(files) - 1; j >= 0; j-- {
+				if item, ok := files[j].values[p]; ok && item.value != nil {
+					if confValueString(item) == value {
+						source = fmt.Sprintf("%s:%d", files[j].name, item.line)
+					}
+					break
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", p, value, source)
+		}
+	}
+	walk(reflect.ValueOf(conf), "")
+	tw.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	beeJSON, err := parseConfFile("bee.json", []byte(`{
+	"version": 0,
+	"go_install": "yes",
+	"dir_structure": {
+		"controlers": "ctl"
+	},
+	"deploy": {
+		"path": "/opt/a",
+		"keep": 5
+	}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	beefile, err := parseConfFile("Beefile", []byte(`deploy:
+  path: /opt/b
+  keep: 5
+watch_ext:
+  - .tpl
+  - 3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, warns := validateConfig([]*confFile{beeJSON, beefile})
+	wantErrs := []string{
+		`bee.json:3: "go_install" must be a boolean, not "yes"`,
+		`bee.json:5: unknown key "dir_structure.controlers"`,
+		`Beefile:4: "watch_ext" must be a list of strings, not [".tpl",3]`,
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("errors:\n%q\nwant:\n%q", errs, wantErrs)
+	}
+	wantWarns := []string{
+		`"deploy.path" is "/opt/a" in bee.json:8 and "/opt/b" in Beefile:2, the value of Beefile is used`,
+	}
+	if !reflect.DeepEqual(warns, wantWarns) {
+		t.Errorf("warnings:\n%q\nwant:\n%q", warns, wantWarns)
+	}
+}
+
+func TestParseConfFileSyntaxError(t *testing.T) {
+	_, err := parseConfFile("bee.json", []byte("{\n\t\"version\": 0,\n\t\"envs\": [}\n"))
+	if err == nil || err.Error()[:16] != "bee.json: line 3" {
+		t.Errorf("got %v", err)
+	}
+}
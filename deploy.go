@@ -0,0 +1,464 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var cmdDeploy = &Command{
+	UsageLine: "deploy [rollback] [-p=.] [-a=archive] [-hosts=host,...]",
+	Short:     "deploy a beego project to servers over SSH",
+	Long: `
+Deploy packs the app with 'bee pack' and installs it on the servers listed in
+"deploy" in bee.json:
+
+    "deploy": {
+        "hosts": ["deploy@web1.example.com", "web2.example.com:2222"],
+        "path": "/opt/myapp",
+        "restart": "sudo systemctl restart myapp",
+        "keep": 5
+    }
+
+On each server, in turn, the archive is uploaded and extracted to a new
+release directory, path/releases/<time>, the symlink path/current is switched
+to it, the restart command is run in path/current, and only the last "keep"
+releases are kept.
+
+    bee deploy rollback    switches current back to the previous release and
+                           runs the restart command again
+
+-p        app path, the default is the current path
+-a        archive to deploy instead of packing the app: tar.gz, tar.xz, tar.zst,
+          tar or zip
+-hosts    comma separated servers, instead of "hosts" of bee.json
+
+The app is built for "goos" and "goarch" of "deploy", linux and the local
+architecture by default. The user is the one of the host, else "user", else
+the local user. Keys come from the ssh-agent and from "key", or else from
+~/.ssh/id_ed25519, id_ecdsa and id_rsa. Servers must be in "known_hosts",
+~/.ssh/known_hosts by default.
+`,
+}
+
+var (
+	deployAppPath string
+	deployArchive string
+	deployHosts   string
+)
+
+func init() {
+	cmdDeploy.Run = deployApp
+	cmdDeploy.Flag.StringVar(&deployAppPath, "p", "", "app path. default is current path")
+	cmdDeploy.Flag.StringVar(&deployArchive, "a", "", "archive to deploy. default is packing the app")
+	cmdDeploy.Flag.StringVar(&deployHosts, "hosts", "", "comma separated servers. default is hosts of bee.json")
+}
+
+func deployApp(cmd *Command, args []string) int {
+	rollback := len(args) > 0 && args[0] == "rollback"
+	if rollback {
+		// flags may follow the subcommand too
+		cmd.Flag.Parse(args[1:])
+		args = cmd.Flag.Args()
+	} else if len(args) > 0 {
+		ColorLog("[ERRO] Unknown deploy command '%s'\n", args[0])
+		ColorLog("[HINT] Usage: bee deploy [rollback]\n")
+		os.Exit(2)
+	}
+
+	curPath, _ := os.Getwd()
+	apppath := deployAppPath
+	if !filepath.IsAbs(apppath) {
+		apppath = filepath.Join(curPath, apppath)
+	}
+	// ./pack_pkg.go
+	loadPackConf(apppath)
+	dc := conf.Deploy
+
+	hosts := dc.Hosts
+	if deployHosts != "" {
+		hosts = strings.Split(deployHosts, ",")
+	}
+	if len(hosts) == 0 {
+		ColorLog("[ERRO] No hosts to deploy to\n")
+		ColorLog("[HINT] Set \"hosts\" of \"deploy\" in bee.json, or use -hosts\n")
+		os.Exit(2)
+	}
+	if dc.Path == "" {
+		ColorLog("[ERRO] No deploy path\n")
+		ColorLog("[HINT] Set \"path\" of \"deploy\" in bee.json, e.g. /opt/%s\n", filepath.Base(apppath))
+		os.Exit(2)
+	}
+
+	auth, err := deployAuth(dc.Key)
+	if err != nil {
+		ColorLog("[ERRO] %s\n", err)
+		os.Exit(2)
+	}
+	hostKey, err := deployHostKey(dc.KnownHosts)
+	if err != nil {
+		ColorLog("[ERRO] Could not read the known hosts: %s\n", err)
+		os.Exit(2)
+	}
+
+	archive := deployArchive
+	if !rollback {
+		if archive == "" {
+			archive = packForDeploy(apppath, dc.GOOS, dc.GOARCH)
+		}
+		if _, err := extractCommand(archive); err != nil {
+			ColorLog("[ERRO] %s\n", err)
+			os.Exit(2)
+		}
+	}
+
+	release := time.Now().UTC().Format("20060102150405")
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		addr, userName := splitDeployHost(host, dc.User)
+		ColorLog("[INFO] Connecting to %s@%s\n", userName, addr)
+		client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+			User:            userName,
+			Auth:            auth,
+			HostKeyCallback: hostKey,
+			Timeout:         30 * time.Second,
+		})
+		if err != nil {
+			ColorLog("[ERRO] %s: %s\n", host, err)
+			if strings.Contains(err.Error(), "key is unknown") {
+				ColorLog("[HINT] Add the server to the known hosts, e.g. ssh-keyscan %s >> ~/.ssh/known_hosts\n", strings.Split(addr, ":")[0])
+			}
+			os.Exit(2)
+		}
+		d := newDeployer(client, dc.Path, dc.Restart, os.Stdout)
+		if rollback {
+			var prev string
+			if prev, err = d.rollback(); err == nil {
+				ColorLog("[SUCC] %s: rolled back to release %s\n", host, prev)
+			}
+		} else {
+			if err = d.deploy(archive, release, dc.Keep); err == nil {
+				ColorLog("[SUCC] %s: release %s is live\n", host, release)
+			}
+		}
+		client.Close()
+		if err != nil {
+			ColorLog("[ERRO] %s: %s\n", host, err)
+			os.Exit(2)
+		}
+	}
+	if !rollback && deployArchive == "" {
+		os.RemoveAll(filepath.Dir(archive))
+	}
+	return 0
+}
+
+// packForDeploy packs the app at apppath with bee pack in a temporary
+// directory and returns the path of the archive.
+func packForDeploy(apppath, goos, goarch string) string {
+	if goos == "" {
+		goos = "linux"
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+	tmpdir, err := ioutil.TempDir("", "beeDeploy")
+	if err != nil {
+		ColorLog("[ERRO] %s\n", err)
+		os.Exit(2)
+	}
+	// ./pack.go, which leaves the path of the archive in outputP
+	packApp(cmdPack, []string{"-p=" + apppath, "-o=" + tmpdir, "-f=tar.gz",
+		"-be=GOOS=" + goos, "-be=GOARCH=" + goarch})
+	return outputP
+}
+
+// splitDeployHost splits a [user@]host[:port] server into its address
+// and user. The user defaults to defUser, then to the local user.
+func splitDeployHost(host, defUser string) (addr, userName string) {
+	userName = defUser
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		userName, host = host[:i], host[i+1:]
+	}
+	if userName == "" {
+		if u, err := user.Current(); err == nil {
+			userName = u.Username
+		}
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+	return host, userName
+}
+
+// deployAuth returns the keys of the ssh-agent, and those of the file key
+// or else of the default files of ~/.ssh.
+func deployAuth(key string) ([]ssh.AuthMethod, error) {
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			if s, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, s...)
+			}
+		}
+	}
+
+	files := []string{key}
+	if key == "" {
+		files = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+	}
+	for _, f := range files {
+		pem, err := ioutil.ReadFile(expandHome(f))
+		if err != nil {
+			if key != "" {
+				return nil, err
+			}
+			continue
+		}
+		s, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			if key != "" {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			ColorLog("[WARN] Skipping %s: %s\n", f, err)
+			continue
+		}
+		signers = append(signers, s)
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("no SSH key: start an ssh-agent or set \"key\" of \"deploy\" in bee.json")
+	}
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil
+}
+
+// deployHostKey returns the check of the server keys against the known
+// hosts file, ~/.ssh/known_hosts by default.
+func deployHostKey(file string) (ssh.HostKeyCallback, error) {
+	if file == "" {
+		file = "~/.ssh/known_hosts"
+	}
+	return knownhosts.New(expandHome(file))
+}
+
+func expandHome(fpath string) string {
+	if strings.HasPrefix(fpath, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, fpath[2:])
+		}
+	}
+	return fpath
+}
+
+// extractCommand returns the command extracting the archive in the
+// current directory.
+func extractCommand(archive string) (string, error) {
+	switch {
+	case strings.HasSuffix(archive, ".tar.gz"), strings.HasSuffix(archive, ".tgz"):
+		return "tar -xzf", nil
+	case strings.HasSuffix(archive, ".tar.xz"):
+		return "tar -xJf", nil
+	case strings.HasSuffix(archive, ".tar.zst"):
+		return "tar --zstd -xf", nil
+	case strings.HasSuffix(archive, ".tar"):
+		return "tar -xf", nil
+	case strings.HasSuffix(archive, ".zip"):
+		return "unzip -qo", nil
+	}
+	return "", fmt.Errorf("Can not deploy %s: use a tar.gz, tar.xz, tar.zst, tar or zip archive", archive)
+}
+
+// shellQuote quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// deployer deploys releases of the app in the directory path of a server:
+//
+//	path/releases/20210102150405/   one directory per release
+//	path/current -> releases/20210102150405
+type deployer struct {
+	client  *ssh.Client
+	path    string
+	restart string
+	out     io.Writer // output of the restart command
+}
+
+func newDeployer(client *ssh.Client, path, restart string, out io.Writer) *deployer {
+	return &deployer{client: client, path: strings.TrimSuffix(path, "/"), restart: restart, out: out}
+}
+
+// run runs the command cmd with sh on the server and returns its output.
+func (d *deployer) run(cmd string, stdin io.Reader) (string, error) {
+	s, err := d.client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+	var stdout, stderr bytes.Buffer
+	s.Stdin = stdin
+	s.Stdout = &stdout
+	s.Stderr = &stderr
+	if err := s.Run(cmd); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", cmd, msg)
+		}
+		return "", fmt.Errorf("%s: %v", cmd, err)
+	}
+	return stdout.String(), nil
+}
+
+// upload copies the local file src to the file dst of the server.
+func (d *deployer) upload(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = d.run("cat > "+shellQuote(dst), f)
+	return err
+}
+
+// deploy installs the archive as the release name, makes it the current
+// one, restarts the app and removes the releases older than the last keep,
+// 5 by default.
+func (d *deployer) deploy(archive, name string, keep int) error {
+	extract, err := extractCommand(archive)
+	if err != nil {
+		return err
+	}
+	// releases are named after the second they are deployed at, a
+	// directory already there belongs to another deploy
+	dir := d.path + "/releases/" + name
+	if _, err := d.run(fmt.Sprintf("mkdir -p %s && mkdir %s", shellQuote(d.path+"/releases"), shellQuote(dir)), nil); err != nil {
+		return fmt.Errorf("could not create release %s, a deploy at the same second may have created it: %v", name, err)
+	}
+	remote := dir + "/" + filepath.Base(archive)
+	ColorLog("[INFO] Uploading %s to %s\n", filepath.Base(archive), dir)
+	if err := d.upload(archive, remote); err != nil {
+		return err
+	}
+	if _, err := d.run(fmt.Sprintf("cd %s && %s %s && rm -f %s", shellQuote(dir), extract,
+		shellQuote(remote), shellQuote(remote)), nil); err != nil {
+		return err
+	}
+	if err := d.activate(name); err != nil {
+		return err
+	}
+	if keep <= 0 {
+		keep = 5
+	}
+	return d.prune(keep)
+}
+
+// rollback makes the release before the current one the current one and
+// restarts the app.
+func (d *deployer) rollback() (string, error) {
+	releases, current, err := d.releases()
+	if err != nil {
+		return "", err
+	}
+	prev, err := previousRelease(releases, current)
+	if err != nil {
+		return "", err
+	}
+	return prev, d.activate(prev)
+}
+
+// activate switches the current symlink to the release name and runs the
+// restart command. The new link is renamed over the current one, so that
+// current always points to a release.
+func (d *deployer) activate(name string) error {
+	ColorLog("[INFO] Switching %s/current to release %s\n", d.path, name)
+	tmp := shellQuote(d.path + "/current.tmp")
+	if _, err := d.run(fmt.Sprintf("ln -sfn %s %s && mv -T %s %s", shellQuote("releases/"+name), tmp,
+		tmp, shellQuote(d.path+"/current")), nil); err != nil {
+		return err
+	}
+	if d.restart == "" {
+		return nil
+	}
+	ColorLog("[INFO] Restarting: %s\n", d.restart)
+	out, err := d.run(fmt.Sprintf("cd %s && %s", shellQuote(d.path+"/current"), d.restart), nil)
+	io.WriteString(d.out, out)
+	return err
+}
+
+// releases returns the releases of the server, oldest first, and the
+// current one.
+func (d *deployer) releases() ([]string, string, error) {
+	out, err := d.run("ls -1 "+shellQuote(d.path+"/releases"), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	releases := strings.Fields(out)
+	sort.Strings(releases)
+	// there is no current release before the first deploy
+	link, _ := d.run("readlink "+shellQuote(d.path+"/current"), nil)
+	return releases, filepath.Base(strings.TrimSpace(link)), nil
+}
+
+// prune removes the releases older than the last keep ones, except the
+// current one.
+func (d *deployer) prune(keep int) error {
+	releases, current, err := d.releases()
+	if err != nil || len(releases) <= keep {
+		return err
+	}
+	var old []string
+	for _, r := range releases[:len(releases)-keep] {
+		if r != current {
+			old = append(old, shellQuote(d.path+"/releases/"+r))
+		}
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	ColorLog("[INFO] Removing %d old release(s)\n", len(old))
+	_, err = d.run("rm -rf "+strings.Join(old, " "), nil)
+	return err
+}
+
+// previousRelease returns the release before current in releases, which
+// are sorted.
+func previousRelease(releases []string, current string) (string, error) {
+	for i, r := range releases {
+		if r == current {
+			if i == 0 {
+				return "", fmt.Errorf("release %s is the oldest one, there is nothing to roll back to", current)
+			}
+			return releases[i-1], nil
+		}
+	}
+	return "", fmt.Errorf("current release %q not found in releases", current)
+}
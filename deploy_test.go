@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHServer starts an SSH server running the exec requests with sh on
+// the local machine, and returns a client logged in with the key it accepts.
+func startSSHServer(t *testing.T) *ssh.Client {
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, userPriv, _ := ed25519.GenerateKey(rand.Reader)
+	userKey, err := ssh.NewSignerFromKey(userPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(userKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "deploy",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(userKey)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			for req := range reqs {
+				if req.Type != "exec" || len(req.Payload) < 4 {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				cmd := exec.Command("sh", "-c", string(req.Payload[4:]))
+				cmd.Stdin = ch
+				cmd.Stdout = ch
+				cmd.Stderr = ch.Stderr()
+				status := uint32(0)
+				if err := cmd.Run(); err != nil {
+					status = 1
+					if e, ok := err.(*exec.ExitError); ok {
+						status = uint32(e.ExitCode())
+					}
+				}
+				payload := make([]byte, 4)
+				binary.BigEndian.PutUint32(payload, status)
+				ch.SendRequest("exit-status", false, payload)
+				return
+			}
+		}()
+	}
+}
+
+func writeTestArchive(t *testing.T, fpath, content string) {
+	f, err := os.Create(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "VERSION", Mode: 0644, Size: int64(len(content))})
+	tw.Write([]byte(content))
+	tw.Close()
+	gw.Close()
+}
+
+func TestDeploy(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar is needed")
+	}
+	client := startSSHServer(t)
+	root := t.TempDir()
+	remote := filepath.Join(root, "srv", "myapp")
+	d := newDeployer(client, remote, "cat VERSION >> ../../restarts", ioutil.Discard)
+
+	for i, release := range []string{"20210101000000", "20210102000000", "20210103000000"} {
+		archive := filepath.Join(root, "myapp.tar.gz")
+		writeTestArchive(t, archive, "v"+string(rune('1'+i))+"\n")
+		if err := d.deploy(archive, release, 2); err != nil {
+			t.Fatal(err)
+		}
+		if link, _ := os.Readlink(filepath.Join(remote, "current")); link != "releases/"+release {
+			t.Fatalf("current is %q after deploying %s", link, release)
+		}
+	}
+
+	archive := filepath.Join(root, "myapp.tar.gz")
+	if err := d.deploy(archive, "20210103000000", 2); err == nil {
+		t.Error("deploying over an existing release should fail")
+	}
+	if _, err := os.Lstat(filepath.Join(remote, "current.tmp")); !os.IsNotExist(err) {
+		t.Error("current.tmp should be renamed to current")
+	}
+
+	entries, _ := ioutil.ReadDir(filepath.Join(remote, "releases"))
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got := strings.Join(names, ","); got != "20210102000000,20210103000000" {
+		t.Errorf("releases kept: %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(remote, "releases", "20210103000000", "myapp.tar.gz")); !os.IsNotExist(err) {
+		t.Error("the archive should be removed once extracted")
+	}
+
+	prev, err := d.rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev != "20210102000000" {
+		t.Errorf("rolled back to %s", prev)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(remote, "current", "VERSION")); string(data) != "v2\n" {
+		t.Errorf("current VERSION is %q", data)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(remote, "restarts")); string(data) != "v1\nv2\nv3\nv2\n" {
+		t.Errorf("restarts: %q", data)
+	}
+	if _, err := d.rollback(); err == nil {
+		t.Error("rolling back past the oldest release should fail")
+	}
+}
+
+func TestSplitDeployHost(t *testing.T) {
+	cases := []struct{ host, addr, user string }{
+		{"web1", "web1:22", "bee"},
+		{"deploy@web1:2222", "web1:2222", "deploy"},
+		{"[::1]", "[::1]:22", "bee"},
+	}
+	for _, c := range cases {
+		addr, u := splitDeployHost(c.host, "bee")
+		if addr != c.addr || u != c.user {
+			t.Errorf("%s: got %s %s, want %s %s", c.host, addr, u, c.addr, c.user)
+		}
+	}
+}
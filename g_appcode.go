@@ -17,6 +17,7 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
@@ -179,11 +180,13 @@ type OrmTag struct {
 	RelFk       bool
 	ReverseMany bool
 	RelM2M      bool
+	RelThrough  string
+	RelTable    string
 }
 
 // String returns the source code string for the Table struct
 func (tb *Table) String() string {
-	rv := fmt.Sprintf("type %s struct {\n", camelCase(tb.Name))
+	rv := fmt.Sprintf("type %s struct {\n", modelName(tb.Name))
 	for _, v := range tb.Columns {
 		rv += v.String() + "\n"
 	}
@@ -194,7 +197,18 @@ func (tb *Table) String() string {
 // String returns the source code string of a field in Table struct
 // It maps to a column in database table. e.g. Id int `orm:"column(id);auto"`
 func (col *Column) String() string {
-	return fmt.Sprintf("%s %s %s", col.Name, col.Type, col.Tag.String())
+	tag := col.Tag.String()
+	// sized strings are checked by the generated controllers
+	if col.Type == "string" && col.Tag.Size != "" {
+		rules, _ := validRules("string", col.Tag.Size, nil)
+		valid := "valid:\"" + rules + "\"`"
+		if tag == "" {
+			tag = "`" + valid
+		} else {
+			tag = strings.TrimSuffix(tag, "`") + " " + valid
+		}
+	}
+	return fmt.Sprintf("%s %s %s", col.Name, col.Type, tag)
 }
 
 // String returns the ORM tag string for a column
@@ -239,6 +253,12 @@ func (tag *OrmTag) String() string {
 	if tag.RelM2M {
 		ormOptions = append(ormOptions, "rel(m2m)")
 	}
+	if tag.RelThrough != "" {
+		ormOptions = append(ormOptions, fmt.Sprintf("rel_through(%s)", tag.RelThrough))
+	}
+	if tag.RelTable != "" {
+		ormOptions = append(ormOptions, fmt.Sprintf("rel_table(%s)", tag.RelTable))
+	}
 	if tag.Pk {
 		ormOptions = append(ormOptions, "pk")
 	}
@@ -269,12 +289,17 @@ func generateAppcode(driver, connStr, level, tables, currpath string) {
 		ColorLog("[HINT] Level must be either 1, 2 or 3\n")
 		os.Exit(2)
 	}
-	var selectedTables map[string]bool
-	if tables != "" {
-		selectedTables = make(map[string]bool)
-		for _, v := range strings.Split(tables, ",") {
-			selectedTables[v] = true
-		}
+	switch transport {
+	case "rest", "grpc":
+	default:
+		ColorLog("[ERRO] Invalid 'transport' option: %s\n", transport)
+		ColorLog("[HINT] Transport must be either rest or grpc\n")
+		os.Exit(2)
+	}
+	filter, err := newTableFilter(tables, excludeTables.String(), excludeColumns.String())
+	if err != nil {
+		ColorLog("[ERRO] Invalid table filter: %s\n", err)
+		os.Exit(2)
 	}
 	switch driver {
 	case "mysql":
@@ -287,12 +312,125 @@ func generateAppcode(driver, connStr, level, tables, currpath string) {
 		ColorLog("[HINT] Driver must be one of mysql, postgres or sqlite\n")
 		os.Exit(2)
 	}
-	gen(driver, connStr, mode, selectedTables, currpath)
+	gen(driver, connStr, mode, filter, currpath)
+}
+
+// tableFilter selects the tables and columns generate appcode works on.
+// Patterns are globs as understood by path.Match, or regular expressions
+// when wrapped in slashes, e.g. /^audit_/.
+type tableFilter struct {
+	include []string
+	exclude []string
+	// columns holds column patterns, either "column" or "table.column"
+	columns []string
+}
+
+// newTableFilter parses comma separated pattern lists and checks
+// that every pattern is valid.
+func newTableFilter(include, exclude, columns string) (*tableFilter, error) {
+	f := &tableFilter{
+		include: splitPatterns(include),
+		exclude: splitPatterns(exclude),
+		columns: splitPatterns(columns),
+	}
+	for _, list := range [][]string{f.include, f.exclude, f.columns} {
+		for _, p := range list {
+			if _, err := matchPattern(p, ""); err != nil {
+				return nil, fmt.Errorf("%s: %s", p, err)
+			}
+		}
+	}
+	return f, nil
+}
+
+// selectTables returns the set of table names that pass the include and
+// exclude patterns, or nil if no pattern is given and every table is selected.
+func (f *tableFilter) selectTables(tableNames []string) map[string]bool {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return nil
+	}
+	selected := make(map[string]bool)
+	for _, name := range tableNames {
+		if len(f.include) > 0 && !matchAny(f.include, name) {
+			continue
+		}
+		if matchAny(f.exclude, name) {
+			continue
+		}
+		selected[name] = true
+	}
+	return selected
+}
+
+// filterColumns drops the excluded columns from every table. Primary keys
+// are kept since the generated models cannot work without them.
+func (f *tableFilter) filterColumns(tables []*Table) {
+	if len(f.columns) == 0 {
+		return
+	}
+	for _, tb := range tables {
+		var kept []*Column
+		tb.ImportTimePkg = false
+		for _, col := range tb.Columns {
+			if matchAny(f.columns, col.Tag.Column) || matchAny(f.columns, tb.Name+"."+col.Tag.Column) {
+				if col.Tag.Column != tb.Pk {
+					continue
+				}
+				ColorLog("[WARN] Cannot exclude primary key '%s.%s'\n", tb.Name, col.Tag.Column)
+			}
+			if col.Type == "time.Time" {
+				tb.ImportTimePkg = true
+			}
+			kept = append(kept, col)
+		}
+		tb.Columns = kept
+	}
+}
+
+func splitPatterns(list string) (patterns []string) {
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return
+}
+
+// matchPattern reports whether name matches a glob or a /regexp/ pattern
+func matchPattern(pattern, name string) (bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.MatchString(pattern[1:len(pattern)-1], name)
+	}
+	return path.Match(pattern, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := matchPattern(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// modelName returns the Go identifier for a table, with the first matching
+// prefix given by -prefix stripped, e.g. tbl_user_role => UserRole
+func modelName(tbName string) string {
+	return camelCase(trimTablePrefix(tbName))
+}
+
+func trimTablePrefix(tbName string) string {
+	for _, prefix := range splitPatterns(tablePrefix.String()) {
+		if strings.HasPrefix(tbName, prefix) && len(tbName) > len(prefix) {
+			return tbName[len(prefix):]
+		}
+	}
+	return tbName
 }
 
 // Generate takes table, column and foreign key information from database connection
 // and generate corresponding golang source files
-func gen(dbms, connStr string, mode byte, selectedTableNames map[string]bool, apppath string) {
+func gen(dbms, connStr string, mode byte, filter *tableFilter, apppath string) {
 	db, err := sql.Open(dbms, connStr)
 	if err != nil {
 		ColorLog("[ERRO] Could not connect to %s database: %s, %s\n", dbms, connStr, err)
@@ -302,14 +440,22 @@ func gen(dbms, connStr string, mode byte, selectedTableNames map[string]bool, ap
 	if trans, ok := dbDriver[dbms]; ok {
 		ColorLog("[INFO] Analyzing database tables...\n")
 		tableNames := trans.GetTableNames(db)
-		tables := getTableObjects(tableNames, db, trans)
+		selected := filter.selectTables(tableNames)
+		tables, err := getTableObjects(tableNames, selected, db, trans)
+		if err != nil {
+			ColorLog("[ERRO] %s\n", err)
+			ColorLog("[HINT] Leave one of the tables out with -exclude or change -prefix\n")
+			os.Exit(2)
+		}
+		filter.filterColumns(tables)
 		mvcPath := new(MvcPath)
 		mvcPath.ModelPath = path.Join(apppath, "models")
 		mvcPath.ControllerPath = path.Join(apppath, "controllers")
 		mvcPath.RouterPath = path.Join(apppath, "routers")
 		createPaths(mode, mvcPath)
 		pkgPath := getPackagePath(apppath)
-		writeSourceFiles(pkgPath, tables, mode, mvcPath, selectedTableNames)
+		buildRelations(tables, pkgPath)
+		writeSourceFiles(pkgPath, tables, mode, mvcPath, selected)
 	} else {
 		ColorLog("[ERRO] Generating app code from %s database is not supported yet.\n", dbms)
 		os.Exit(2)
@@ -336,14 +482,27 @@ func (*MysqlDB) GetTableNames(db *sql.DB) (tables []string) {
 	return
 }
 
-// getTableObjects process each table name
-func getTableObjects(tableNames []string, db *sql.DB, dbTransformer DbTransformer) (tables []*Table) {
+// getTableObjects process each table name. It fails if two of the tables
+// get the same model name once -prefix is trimmed, e.g. app_user and user.
+func getTableObjects(tableNames []string, selected map[string]bool, db *sql.DB, dbTransformer DbTransformer) (tables []*Table, err error) {
 	// if a table has a composite pk or doesn't have pk, we can't use it yet
 	// these tables will be put into blacklist so that other struct will not
 	// reference it.
 	blackList := make(map[string]bool)
+	models := make(map[string]string)
 	// process constraints information for each table, also gather blacklisted table names
 	for _, tableName := range tableNames {
+		// tables left out by -tables/-exclude are not generated, so the
+		// foreign keys pointing to them stay plain columns
+		if selected != nil && !selected[tableName] {
+			blackList[tableName] = true
+			continue
+		}
+		name := modelName(tableName)
+		if other, ok := models[name]; ok {
+			return nil, fmt.Errorf("tables %s and %s would both become the model %s", other, tableName, name)
+		}
+		models[name] = tableName
 		// create a table struct
 		tb := new(Table)
 		tb.Name = tableName
@@ -358,6 +517,132 @@ func getTableObjects(tableNames []string, db *sql.DB, dbTransformer DbTransforme
 	return
 }
 
+// buildRelations adds the navigable relation fields beego orm cannot infer
+// from foreign key columns alone. Junction tables, i.e. tables made of a
+// primary key and two foreign keys, turn into a rel(m2m) field on the first
+// referenced model and a reverse(many) field on the second, both going
+// through the junction model. Junction tables without a primary key of
+// their own, e.g. with a composite one, have no model to go through: the
+// rel(m2m) field names the table with rel_table, which beego orm accepts
+// when the columns are <table>_id of the two referenced tables. Every other
+// foreign key gets a reverse(many) field on the referenced model.
+func buildRelations(tables []*Table, pkgPath string) {
+	tableMap := make(map[string]*Table)
+	junctions := make(map[string][]string)
+	for _, tb := range tables {
+		tableMap[tb.Name] = tb
+		// detect junctions up front, adding relation fields changes the columns
+		if refs := tb.junctionRefs(); refs != nil {
+			junctions[tb.Name] = refs
+		}
+	}
+	for _, tb := range tables {
+		if refs, ok := junctions[tb.Name]; ok {
+			left, right := tableMap[refs[0]], tableMap[refs[1]]
+			if left == nil || right == nil || left.Pk == "" || right.Pk == "" {
+				continue
+			}
+			if tb.Pk != "" {
+				through := pkgPath + "/models." + modelName(tb.Name)
+				left.addRelation(right, &OrmTag{RelM2M: true, RelThrough: through})
+				right.addRelation(left, &OrmTag{ReverseMany: true, RelThrough: through})
+			} else if tb.relTableColumns(left, right) {
+				left.addRelation(right, &OrmTag{RelM2M: true, RelTable: tb.Name})
+				right.addRelation(left, &OrmTag{ReverseMany: true})
+			}
+			continue
+		}
+		if tb.Pk == "" {
+			continue
+		}
+		referenced := make(map[string]bool)
+		for _, col := range tb.Columns {
+			if !col.Tag.RelFk {
+				continue
+			}
+			fk := tb.Fk[col.Tag.Column]
+			ref := tableMap[fk.RefTable]
+			// beego orm pairs a reverse field with the first foreign key
+			// pointing back, so one reverse field per table is enough
+			if ref == nil || ref.Pk == "" || referenced[ref.Name] {
+				continue
+			}
+			referenced[ref.Name] = true
+			ref.addRelation(tb, &OrmTag{ReverseMany: true})
+		}
+	}
+}
+
+// templateData returns the data user templates of the table are rendered with
+func (tb *Table) templateData(filename, pkgPath string) *AppcodeTemplateData {
+	return &AppcodeTemplateData{
+		ModelName:   modelName(tb.Name),
+		TableName:   tb.Name,
+		FileName:    filename,
+		ModelStruct: tb.String(),
+		ImportTime:  tb.ImportTimePkg,
+		PkgPath:     pkgPath,
+		Table:       tb,
+	}
+}
+
+// junctionRefs returns the names of the two tables a junction table links,
+// or nil if the table carries anything besides its primary key, if it has
+// one of its own, and two foreign keys to distinct tables.
+func (tb *Table) junctionRefs() []string {
+	n := 3
+	if tb.Pk == "" {
+		n = 2
+	}
+	if len(tb.Columns) != n {
+		return nil
+	}
+	var refs []string
+	for _, col := range tb.Columns {
+		if tb.Pk != "" && col.Tag.Column == tb.Pk {
+			continue
+		}
+		if !col.Tag.RelFk {
+			return nil
+		}
+		refs = append(refs, tb.Fk[col.Tag.Column].RefTable)
+	}
+	if len(refs) != 2 || refs[0] == refs[1] {
+		return nil
+	}
+	return refs
+}
+
+// relTableColumns reports whether the junction table tb can back a
+// rel_table m2m field of left: its columns must be left_id and right_id,
+// referencing the primary keys of left and right.
+func (tb *Table) relTableColumns(left, right *Table) bool {
+	for _, ref := range []*Table{left, right} {
+		fk := tb.Fk[ref.Name+"_id"]
+		if fk == nil || fk.RefTable != ref.Name || fk.RefColumn != ref.Pk {
+			return false
+		}
+	}
+	return true
+}
+
+// addRelation appends a []*Model field pointing to the ref table, renaming
+// it if the struct already has a field with the same name.
+func (tb *Table) addRelation(ref *Table, tag *OrmTag) {
+	name := pluralize(modelName(ref.Name))
+	for _, col := range tb.Columns {
+		if col.Name == name {
+			name += "Rel"
+			break
+		}
+	}
+	col := new(Column)
+	col.Name = name
+	col.Type = "[]*" + modelName(ref.Name)
+	col.Tag = tag
+	tb.Columns = append(tb.Columns, col)
+}
+
 // getConstraints gets primary key, unique key and foreign keys of a table from information_schema
 // and fill in Table struct
 func (*MysqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
@@ -454,7 +739,7 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 				tag.RelFk = true
 				refStructName := fkCol.RefTable
 				col.Name = camelCase(colName)
-				col.Type = "*" + camelCase(refStructName)
+				col.Type = "*" + modelName(refStructName)
 			} else {
 				// if the name of column is Id, and it's not primary key
 				if colName == "id" {
@@ -650,7 +935,7 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 				tag.RelFk = true
 				refStructName := fkCol.RefTable
 				col.Name = camelCase(colName)
-				col.Type = "*" + camelCase(refStructName)
+				col.Type = "*" + modelName(refStructName)
 			} else {
 				// if the name of column is Id, and it's not primary key
 				if colName == "id" {
@@ -704,6 +989,10 @@ func createPaths(mode byte, paths *MvcPath) {
 	if (mode & OModel) == OModel {
 		os.Mkdir(paths.ModelPath, 0777)
 	}
+	if transport == "grpc" {
+		// writeProtoFiles creates the directories of the grpc transport
+		return
+	}
 	if (mode & OController) == OController {
 		os.Mkdir(paths.ControllerPath, 0777)
 	}
@@ -713,13 +1002,28 @@ func createPaths(mode byte, paths *MvcPath) {
 }
 
 // writeSourceFiles generates source files for model/controller/router
-// It will wipe the following directories and recreate them:./models, ./controllers, ./routers
-// Newly geneated files will be inside these folders.
+// Models and controllers are split in two: <name>_gen.go is owned by bee and
+// rewritten on every run, <name>.go is created once and left to the user.
+// The router keeps its namespaces between guard comments in router.go.
+// With -transport=grpc, proto files and grpc servers replace controllers,
+// and rpc/register_gen.go replaces the router.
 func writeSourceFiles(pkgPath string, tables []*Table, mode byte, paths *MvcPath, selectedTables map[string]bool) {
 	if (OModel & mode) == OModel {
 		ColorLog("[INFO] Creating model files...\n")
 		writeModelFiles(tables, paths.ModelPath, selectedTables)
 	}
+	if transport == "grpc" {
+		apppath := path.Dir(paths.ModelPath)
+		if (OController & mode) == OController {
+			ColorLog("[INFO] Creating proto and grpc server files...\n")
+			writeProtoFiles(tables, apppath, selectedTables, pkgPath)
+		}
+		if (ORouter & mode) == ORouter {
+			ColorLog("[INFO] Creating grpc register file...\n")
+			writeGrpcRegisterFile(tables, apppath, selectedTables, pkgPath)
+		}
+		return
+	}
 	if (OController & mode) == OController {
 		ColorLog("[INFO] Creating controller files...\n")
 		writeControllerFiles(tables, paths.ControllerPath, selectedTables, pkgPath)
@@ -732,8 +1036,7 @@ func writeSourceFiles(pkgPath string, tables []*Table, mode byte, paths *MvcPath
 
 // writeModelFiles generates model files
 func writeModelFiles(tables []*Table, mPath string, selectedTables map[string]bool) {
-	w := NewColorWriter(os.Stdout)
-
+	writeQueryFile(mPath, "models")
 	for _, tb := range tables {
 		// if selectedTables map is not nil and this table is not selected, ignore it
 		if selectedTables != nil {
@@ -741,37 +1044,23 @@ func writeModelFiles(tables []*Table, mPath string, selectedTables map[string]bo
 				continue
 			}
 		}
-		filename := getFileName(tb.Name)
-		fpath := path.Join(mPath, filename+".go")
-		var f *os.File
-		var err error
-		if isExist(fpath) {
-			ColorLog("[WARN] '%v' already exists. Do you want to overwrite it? [Yes|No] ", fpath)
-			if askForConfirmation() {
-				f, err = os.OpenFile(fpath, os.O_RDWR|os.O_TRUNC, 0666)
-				if err != nil {
-					ColorLog("[WARN] %v\n", err)
-					continue
-				}
-			} else {
-				ColorLog("[WARN] Skipped create file '%s'\n", fpath)
-				continue
-			}
-		} else {
-			f, err = os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0666)
-			if err != nil {
-				ColorLog("[WARN] %v\n", err)
-				continue
-			}
+		filename := getFileName(trimTablePrefix(tb.Name))
+		data := tb.templateData(filename, "")
+		userStr := strings.Replace(UserModelTPL, "{{modelName}}", modelName(tb.Name), -1)
+		userStr = strings.Replace(userStr, "{{fileName}}", filename, -1)
+		userStr = templateOr("appcode/model_user.go", data, userStr)
+		if !claimUserFile(path.Join(mPath, filename+".go"), "type "+modelName(tb.Name)+" struct", userStr) {
+			continue
 		}
-		template := ""
+		template, templateName := "", ""
 		if tb.Pk == "" {
-			template = StructModelTPL
+			template, templateName = StructModelTPL, "appcode/struct.go"
 		} else {
-			template = ModelTPL
+			template, templateName = ModelTPL, "appcode/model.go"
 		}
-		fileStr := strings.Replace(template, "{{modelStruct}}", tb.String(), 1)
-		fileStr = strings.Replace(fileStr, "{{modelName}}", camelCase(tb.Name), -1)
+		fileStr := strings.Replace(template, "{{getAll}}", getAllTpl, 1)
+		fileStr = strings.Replace(fileStr, "{{modelStruct}}", tb.String(), 1)
+		fileStr = strings.Replace(fileStr, "{{modelName}}", modelName(tb.Name), -1)
 		fileStr = strings.Replace(fileStr, "{{tableName}}", tb.Name, -1)
 		// if table contains time field, import time.Time package
 		timePkg := ""
@@ -782,20 +1071,13 @@ func writeModelFiles(tables []*Table, mPath string, selectedTables map[string]bo
 		}
 		fileStr = strings.Replace(fileStr, "{{timePkg}}", timePkg, -1)
 		fileStr = strings.Replace(fileStr, "{{importTimePkg}}", importTimePkg, -1)
-		if _, err := f.WriteString(fileStr); err != nil {
-			ColorLog("[ERRO] Could not write model file to %s\n", fpath)
-			os.Exit(2)
-		}
-		CloseFile(f)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
-		formatSourceCode(fpath)
+		fileStr = templateOr(templateName, data, fileStr)
+		writeGenFile(path.Join(mPath, filename+"_gen.go"), fileStr)
 	}
 }
 
 // writeControllerFiles generates controller files
 func writeControllerFiles(tables []*Table, cPath string, selectedTables map[string]bool, pkgPath string) {
-	w := NewColorWriter(os.Stdout)
-
 	for _, tb := range tables {
 		// if selectedTables map is not nil and this table is not selected, ignore it
 		if selectedTables != nil {
@@ -806,38 +1088,23 @@ func writeControllerFiles(tables []*Table, cPath string, selectedTables map[stri
 		if tb.Pk == "" {
 			continue
 		}
-		filename := getFileName(tb.Name)
-		fpath := path.Join(cPath, filename+".go")
-		var f *os.File
-		var err error
-		if isExist(fpath) {
-			ColorLog("[WARN] '%v' already exists. Do you want to overwrite it? [Yes|No] ", fpath)
-			if askForConfirmation() {
-				f, err = os.OpenFile(fpath, os.O_RDWR|os.O_TRUNC, 0666)
-				if err != nil {
-					ColorLog("[WARN] %v\n", err)
-					continue
-				}
-			} else {
-				ColorLog("[WARN] Skipped create file '%s'\n", fpath)
-				continue
-			}
-		} else {
-			f, err = os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0666)
-			if err != nil {
-				ColorLog("[WARN] %v\n", err)
-				continue
-			}
+		filename := getFileName(trimTablePrefix(tb.Name))
+		data := tb.templateData(filename, pkgPath)
+		userStr := strings.Replace(UserCtrlTPL, "{{ctrlName}}", modelName(tb.Name), -1)
+		userStr = strings.Replace(userStr, "{{fileName}}", filename, -1)
+		userStr = templateOr("appcode/controller_user.go", data, userStr)
+		if !claimUserFile(path.Join(cPath, filename+".go"), "type "+modelName(tb.Name)+"Controller struct", userStr) {
+			continue
 		}
-		fileStr := strings.Replace(CtrlTPL, "{{ctrlName}}", camelCase(tb.Name), -1)
+		fileStr := strings.Replace(CtrlTPL, "{{getAllParams}}", getAllParamsTpl, 1)
+		fileStr = strings.Replace(fileStr, "{{getAllAction}}", strings.Replace(getAllActionTpl, "{{getAll}}", "models.GetAll{{ctrlName}}(q)", 1), 1)
+		fileStr = strings.Replace(fileStr, "{{decode}}", strings.Replace(decodeTpl, "{{ctrlType}}", "{{ctrlName}}Controller", -1), 1)
+		fileStr = strings.Replace(fileStr, "{{ctrlName}}", modelName(tb.Name), -1)
 		fileStr = strings.Replace(fileStr, "{{pkgPath}}", pkgPath, -1)
-		if _, err := f.WriteString(fileStr); err != nil {
-			ColorLog("[ERRO] Could not write controller file to %s\n", fpath)
-			os.Exit(2)
-		}
-		CloseFile(f)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
-		formatSourceCode(fpath)
+		fileStr = templateOr("appcode/controller.go", data, fileStr)
+		writeGenFile(path.Join(cPath, filename+"_gen.go"), fileStr)
+		generateControllerTest(filename, modelName(tb.Name), "/v1/"+tb.Name, pkgPath,
+			path.Join(path.Dir(cPath), "tests"), "appcode/controller_test.go", columnFields(tb))
 	}
 }
 
@@ -858,16 +1125,30 @@ func writeRouterFile(tables []*Table, rPath string, selectedTables map[string]bo
 		}
 		// add namespaces
 		nameSpace := strings.Replace(NamespaceTPL, "{{nameSpace}}", tb.Name, -1)
-		nameSpace = strings.Replace(nameSpace, "{{ctrlName}}", camelCase(tb.Name), -1)
+		nameSpace = strings.Replace(nameSpace, "{{ctrlName}}", modelName(tb.Name), -1)
+		nameSpace = templateOr("appcode/namespace.go", &RouterNamespace{Name: tb.Name, CtrlName: modelName(tb.Name)}, nameSpace)
 		nameSpaces = append(nameSpaces, nameSpace)
 	}
 	// add export controller
 	fpath := path.Join(rPath, "router.go")
 	routerStr := strings.Replace(RouterTPL, "{{nameSpaces}}", strings.Join(nameSpaces, ""), 1)
 	routerStr = strings.Replace(routerStr, "{{pkgPath}}", pkgPath, 1)
+	routerStr = templateOr("appcode/router.go", &RouterTemplateData{PkgPath: pkgPath, Namespaces: strings.Join(nameSpaces, "")}, routerStr)
 	var f *os.File
 	var err error
 	if isExist(fpath) {
+		// only touch the generated region of a router file we wrote before
+		if src, err := ioutil.ReadFile(fpath); err == nil {
+			if content, ok := replaceGuardedRegion(string(src), strings.Join(nameSpaces, "")); ok {
+				if err := ioutil.WriteFile(fpath, []byte(content), 0666); err != nil {
+					ColorLog("[ERRO] Could not write router file to '%s'\n", fpath)
+					os.Exit(2)
+				}
+				fmt.Fprintf(w, "\t%s%supdate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+				formatSourceCode(fpath)
+				return
+			}
+		}
 		ColorLog("[WARN] '%v' already exists. Do you want to overwrite it? [Yes|No] ", fpath)
 		if askForConfirmation() {
 			f, err = os.OpenFile(fpath, os.O_RDWR|os.O_TRUNC, 0666)
@@ -895,6 +1176,65 @@ func writeRouterFile(tables []*Table, rPath string, selectedTables map[string]bo
 	formatSourceCode(fpath)
 }
 
+// writeGenFile (re)writes a file owned by bee, prefixed with the
+// standard "Code generated" header.
+func writeGenFile(fpath, content string) {
+	w := NewColorWriter(os.Stdout)
+
+	action := "create"
+	if isExist(fpath) {
+		action = "update"
+	}
+	if err := ioutil.WriteFile(fpath, []byte(GenHeader+content), 0666); err != nil {
+		ColorLog("[ERRO] Could not write file to %s\n", fpath)
+		os.Exit(2)
+	}
+	fmt.Fprintf(w, "\t%s%s%s%s\t %s%s\n", "\x1b[32m", "\x1b[1m", action, "\x1b[21m", fpath, "\x1b[0m")
+	if strings.HasSuffix(fpath, ".go") {
+		formatSourceCode(fpath)
+	}
+}
+
+// claimUserFile makes sure the user-owned file next to a _gen.go file
+// exists and does not declare what the _gen.go file is about to declare.
+// Files left over from versions of bee without the split still hold the
+// whole generated code; they are only replaced with the user's consent.
+// It returns false if the _gen.go file must not be written.
+func claimUserFile(fpath, decl, content string) bool {
+	w := NewColorWriter(os.Stdout)
+
+	if src, err := ioutil.ReadFile(fpath); err == nil {
+		if !strings.Contains(string(src), decl) {
+			return true
+		}
+		ColorLog("[WARN] '%v' still contains generated code. Do you want to replace it with an empty user file? [Yes|No] ", fpath)
+		if !askForConfirmation() {
+			ColorLog("[WARN] Skipped generating code for '%s'\n", fpath)
+			return false
+		}
+	}
+	if err := ioutil.WriteFile(fpath, []byte(content), 0666); err != nil {
+		ColorLog("[WARN] %v\n", err)
+		return false
+	}
+	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+	return true
+}
+
+// replaceGuardedRegion replaces the lines between the GuardBegin and
+// GuardEnd comments of src. It reports false if src has no such region.
+func replaceGuardedRegion(src, content string) (string, bool) {
+	begin := strings.Index(src, GuardBegin)
+	end := strings.Index(src, GuardEnd)
+	if begin == -1 || end < begin {
+		return src, false
+	}
+	begin += len(GuardBegin)
+	// keep the indentation in front of the end marker
+	end = strings.LastIndex(src[:end], "\n")
+	return src[:begin] + "\n" + strings.Trim(content, "\n") + src[end:], true
+}
+
 // formatSourceCode formats source files
 func formatSourceCode(filename string) {
 	cmd := exec.Command("gofmt", "-w", filename)
@@ -913,6 +1253,18 @@ func camelCase(in string) string {
 	return strings.Join(tokens, "")
 }
 
+// pluralize returns a naive English plural of a field name
+// e.g. Post => Posts, Category => Categories
+func pluralize(in string) string {
+	switch {
+	case strings.HasSuffix(in, "s"):
+		return in
+	case strings.HasSuffix(in, "y") && len(in) > 1 && !strings.ContainsAny(in[len(in)-2:len(in)-1], "aeiou"):
+		return in[:len(in)-1] + "ies"
+	}
+	return in + "s"
+}
+
 func isSQLTemporalType(t string) bool {
 	return t == "date" || t == "datetime" || t == "timestamp" || t == "time"
 }
@@ -1007,6 +1359,24 @@ func getPackagePath(curpath string) (packpath string) {
 }
 
 const (
+	// GenHeader marks the files bee generate appcode rewrites on every run
+	GenHeader = "// Code generated by bee generate appcode. DO NOT EDIT.\n\n"
+	// GuardBegin and GuardEnd enclose the generated part of router.go
+	GuardBegin = "// bee:generated begin"
+	GuardEnd   = "// bee:generated end"
+)
+
+const (
+	UserModelTPL = `package models
+
+// Custom methods and functions for {{modelName}} go here.
+// {{fileName}}_gen.go is rewritten by bee generate appcode, do not edit it.
+`
+	UserCtrlTPL = `package controllers
+
+// Custom actions for {{ctrlName}}Controller go here.
+// {{fileName}}_gen.go is rewritten by bee generate appcode, do not edit it.
+`
 	StructModelTPL = `package models
 {{importTimePkg}}
 {{modelStruct}}
@@ -1015,10 +1385,8 @@ const (
 	ModelTPL = `package models
 
 import (
-	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 	{{timePkg}}
 	"github.com/astaxie/beego/orm"
 )
@@ -1052,80 +1420,7 @@ func Get{{modelName}}ById(id int) (v *{{modelName}}, err error) {
 	return nil, err
 }
 
-// GetAll{{modelName}} retrieves all {{modelName}} matches certain condition. Returns empty list if
-// no records exist
-func GetAll{{modelName}}(query map[string]string, fields []string, sortby []string, order []string,
-	offset int64, limit int64) (ml []interface{}, err error) {
-	o := orm.NewOrm()
-	qs := o.QueryTable(new({{modelName}}))
-	// query k=v
-	for k, v := range query {
-		// rewrite dot-notation to Object__Attribute
-		k = strings.Replace(k, ".", "__", -1)
-		qs = qs.Filter(k, v)
-	}
-	// order by:
-	var sortFields []string
-	if len(sortby) != 0 {
-		if len(sortby) == len(order) {
-			// 1) for each sort field, there is an associated order
-			for i, v := range sortby {
-				orderby := ""
-				if order[i] == "desc" {
-					orderby = "-" + v
-				} else if order[i] == "asc" {
-					orderby = v
-				} else {
-					return nil, errors.New("Error: Invalid order. Must be either [asc|desc]")
-				}
-				sortFields = append(sortFields, orderby)
-			}
-			qs = qs.OrderBy(sortFields...)
-		} else if len(sortby) != len(order) && len(order) == 1 {
-			// 2) there is exactly one order, all the sorted fields will be sorted by this order
-			for _, v := range sortby {
-				orderby := ""
-				if order[0] == "desc" {
-					orderby = "-" + v
-				} else if order[0] == "asc" {
-					orderby = v
-				} else {
-					return nil, errors.New("Error: Invalid order. Must be either [asc|desc]")
-				}
-				sortFields = append(sortFields, orderby)
-			}
-		} else if len(sortby) != len(order) && len(order) != 1 {
-			return nil, errors.New("Error: 'sortby', 'order' sizes mismatch or 'order' size is not 1")
-		}
-	} else {
-		if len(order) != 0 {
-			return nil, errors.New("Error: unused 'order' fields")
-		}
-	}
-
-	var l []{{modelName}}
-	qs = qs.OrderBy(sortFields...)
-	if _, err = qs.Limit(limit, offset).All(&l, fields...); err == nil {
-		if len(fields) == 0 {
-			for _, v := range l {
-				ml = append(ml, v)
-			}
-		} else {
-			// trim unused fields
-			for _, v := range l {
-				m := make(map[string]interface{})
-				val := reflect.ValueOf(v)
-				for _, fname := range fields {
-					m[fname] = val.FieldByName(fname).Interface()
-				}
-				ml = append(ml, m)
-			}
-		}
-		return ml, nil
-	}
-	return nil, err
-}
-
+{{getAll}}
 // Update{{modelName}} updates {{modelName}} by Id and returns error if
 // the record to be updated doesn't exist
 func Update{{modelName}}ById(m *{{modelName}}) (err error) {
@@ -1161,11 +1456,10 @@ func Delete{{modelName}}(id int) (err error) {
 import (
 	"{{pkgPath}}/models"
 	"encoding/json"
-	"errors"
 	"strconv"
-	"strings"
 
 	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/validation"
 )
 
 // {{ctrlName}}Controller oprations for {{ctrlName}}
@@ -1182,22 +1476,23 @@ func (c *{{ctrlName}}Controller) URLMapping() {
 	c.Mapping("Delete", c.Delete)
 }
 
+{{decode}}
 // Post ...
 // @Title Post
 // @Description create {{ctrlName}}
 // @Param	body		body 	models.{{ctrlName}}	true		"body for {{ctrlName}} content"
 // @Success 201 {int} models.{{ctrlName}}
+// @Failure 400 invalid body or validation failed
 // @Failure 403 body is empty
 // @router / [post]
 func (c *{{ctrlName}}Controller) Post() {
 	var v models.{{ctrlName}}
-	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &v); err == nil {
-		if _, err := models.Add{{ctrlName}}(&v); err == nil {
-			c.Ctx.Output.SetStatus(201)
-			c.Data["json"] = v
-		} else {
-			c.Data["json"] = err.Error()
-		}
+	if !c.decode(&v) {
+		return
+	}
+	if _, err := models.Add{{ctrlName}}(&v); err == nil {
+		c.Ctx.Output.SetStatus(201)
+		c.Data["json"] = v
 	} else {
 		c.Data["json"] = err.Error()
 	}
@@ -1226,65 +1521,11 @@ func (c *{{ctrlName}}Controller) GetOne() {
 // GetAll ...
 // @Title Get All
 // @Description get {{ctrlName}}
-// @Param	query	query	string	false	"Filter. e.g. col1:v1,col2:v2 ..."
-// @Param	fields	query	string	false	"Fields returned. e.g. col1,col2 ..."
-// @Param	sortby	query	string	false	"Sorted-by fields. e.g. col1,col2 ..."
-// @Param	order	query	string	false	"Order corresponding to each sortby field, if single value, apply to all sortby fields. e.g. desc,asc ..."
-// @Param	limit	query	string	false	"Limit the size of result set. Must be an integer"
-// @Param	offset	query	string	false	"Start position of result set. Must be an integer"
-// @Success 200 {object} models.{{ctrlName}}
-// @Failure 403
+{{getAllParams}}// @Success 200 {object} models.{{ctrlName}}
+// @Failure 400 invalid query
 // @router / [get]
 func (c *{{ctrlName}}Controller) GetAll() {
-	var fields []string
-	var sortby []string
-	var order []string
-	var query = make(map[string]string)
-	var limit int64 = 10
-	var offset int64
-
-	// fields: col1,col2,entity.col3
-	if v := c.GetString("fields"); v != "" {
-		fields = strings.Split(v, ",")
-	}
-	// limit: 10 (default is 10)
-	if v, err := c.GetInt64("limit"); err == nil {
-		limit = v
-	}
-	// offset: 0 (default is 0)
-	if v, err := c.GetInt64("offset"); err == nil {
-		offset = v
-	}
-	// sortby: col1,col2
-	if v := c.GetString("sortby"); v != "" {
-		sortby = strings.Split(v, ",")
-	}
-	// order: desc,asc
-	if v := c.GetString("order"); v != "" {
-		order = strings.Split(v, ",")
-	}
-	// query: k:v,k:v
-	if v := c.GetString("query"); v != "" {
-		for _, cond := range strings.Split(v, ",") {
-			kv := strings.SplitN(cond, ":", 2)
-			if len(kv) != 2 {
-				c.Data["json"] = errors.New("Error: invalid query key/value pair")
-				c.ServeJSON()
-				return
-			}
-			k, v := kv[0], kv[1]
-			query[k] = v
-		}
-	}
-
-	l, err := models.GetAll{{ctrlName}}(query, fields, sortby, order, offset, limit)
-	if err != nil {
-		c.Data["json"] = err.Error()
-	} else {
-		c.Data["json"] = l
-	}
-	c.ServeJSON()
-}
+{{getAllAction}}}
 
 // Put ...
 // @Title Put
@@ -1292,18 +1533,18 @@ func (c *{{ctrlName}}Controller) GetAll() {
 // @Param	id		path 	string	true		"The id you want to update"
 // @Param	body		body 	models.{{ctrlName}}	true		"body for {{ctrlName}} content"
 // @Success 200 {object} models.{{ctrlName}}
+// @Failure 400 invalid body or validation failed
 // @Failure 403 :id is not int
 // @router /:id [put]
 func (c *{{ctrlName}}Controller) Put() {
 	idStr := c.Ctx.Input.Param(":id")
 	id, _ := strconv.Atoi(idStr)
 	v := models.{{ctrlName}}{Id: id}
-	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &v); err == nil {
-		if err := models.Update{{ctrlName}}ById(&v); err == nil {
-			c.Data["json"] = "OK"
-		} else {
-			c.Data["json"] = err.Error()
-		}
+	if !c.decode(&v) {
+		return
+	}
+	if err := models.Update{{ctrlName}}ById(&v); err == nil {
+		c.Data["json"] = "OK"
 	} else {
 		c.Data["json"] = err.Error()
 	}
@@ -1345,7 +1586,9 @@ import (
 
 func init() {
 	ns := beego.NewNamespace("/v1",
+		// bee:generated begin
 		{{nameSpaces}}
+		// bee:generated end
 	)
 	beego.AddNamespace(ns)
 }
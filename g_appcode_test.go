@@ -0,0 +1,455 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testTable returns a table with an id primary key, a foreign key column
+// for each name=ref of fks and a string column for each of cols.
+func testTable(name string, fks []string, cols ...string) *Table {
+	tb := &Table{Name: name, Pk: "id", Fk: make(map[string]*ForeignKey)}
+	tb.Columns = append(tb.Columns, &Column{Name: "Id", Type: "int", Tag: &OrmTag{Column: "id", Auto: true}})
+	for _, fk := range fks {
+		kv := strings.SplitN(fk, "=", 2)
+		tb.Fk[kv[0]] = &ForeignKey{Name: kv[0], RefTable: kv[1], RefColumn: "id"}
+		tb.Columns = append(tb.Columns, &Column{Name: camelCase(strings.TrimSuffix(kv[0], "_id")), Type: "*" + camelCase(kv[1]), Tag: &OrmTag{Column: kv[0], RelFk: true}})
+	}
+	for _, col := range cols {
+		tb.Columns = append(tb.Columns, &Column{Name: camelCase(col), Type: "string", Tag: &OrmTag{Column: col}})
+	}
+	return tb
+}
+
+// compositeTable returns a table whose primary key is made of its foreign
+// keys, which leaves it without a Pk of its own.
+func compositeTable(name string, fks ...string) *Table {
+	tb := testTable(name, fks)
+	tb.Pk = ""
+	tb.Columns = tb.Columns[1:]
+	return tb
+}
+
+// relations returns the relation fields buildRelations added to tb.
+func relations(tb *Table) string {
+	var rels []string
+	for _, col := range tb.Columns {
+		if !strings.HasPrefix(col.Type, "[]") {
+			continue
+		}
+		s := col.Name + " " + col.Type
+		switch {
+		case col.Tag.RelM2M:
+			s += " m2m"
+		case col.Tag.ReverseMany:
+			s += " reverse"
+		}
+		if col.Tag.RelThrough != "" {
+			s += " through " + col.Tag.RelThrough
+		}
+		if col.Tag.RelTable != "" {
+			s += " table " + col.Tag.RelTable
+		}
+		rels = append(rels, s)
+	}
+	return strings.Join(rels, ", ")
+}
+
+func TestBuildRelations(t *testing.T) {
+	cases := []struct {
+		name   string
+		tables []*Table
+		want   map[string]string
+	}{
+		{
+			"junction",
+			[]*Table{testTable("post", nil, "title"), testTable("tag", nil, "name"), testTable("post_tag", []string{"post_id=post", "tag_id=tag"})},
+			map[string]string{
+				"post":     "Tags []*Tag m2m through app/models.PostTag",
+				"tag":      "Posts []*Post reverse through app/models.PostTag",
+				"post_tag": "",
+			},
+		},
+		{
+			"junction with a payload",
+			[]*Table{testTable("post", nil), testTable("tag", nil), testTable("post_tag", []string{"post_id=post", "tag_id=tag"}, "note")},
+			map[string]string{
+				"post":     "PostTags []*PostTag reverse",
+				"tag":      "PostTags []*PostTag reverse",
+				"post_tag": "",
+			},
+		},
+		{
+			"junction with a composite primary key",
+			[]*Table{testTable("post", nil), testTable("tag", nil), compositeTable("post_tag", "post_id=post", "tag_id=tag")},
+			map[string]string{
+				"post":     "Tags []*Tag m2m table post_tag",
+				"tag":      "Posts []*Post reverse",
+				"post_tag": "",
+			},
+		},
+		{
+			"junction with a composite primary key and other column names",
+			[]*Table{testTable("post", nil), testTable("tag", nil), compositeTable("post_tag", "article=post", "tag_id=tag")},
+			map[string]string{"post": "", "tag": ""},
+		},
+		{
+			"one reverse field per referencing table",
+			[]*Table{testTable("user", nil), testTable("comment", []string{"author_id=user", "editor_id=user"}, "body")},
+			map[string]string{
+				"user":    "Comments []*Comment reverse",
+				"comment": "",
+			},
+		},
+		{
+			"self reference",
+			[]*Table{testTable("category", []string{"parent_id=category"}, "name")},
+			map[string]string{"category": "Categories []*Category reverse"},
+		},
+		{
+			"name taken by a column",
+			[]*Table{testTable("post", nil, "tags"), testTable("tag", nil), testTable("post_tag", []string{"post_id=post", "tag_id=tag"})},
+			map[string]string{"post": "TagsRel []*Tag m2m through app/models.PostTag"},
+		},
+		{
+			"reference to a table that is not generated",
+			[]*Table{testTable("comment", []string{"user_id=user"}), testTable("post_tag", []string{"post_id=post", "tag_id=tag"})},
+			map[string]string{"comment": "", "post_tag": ""},
+		},
+	}
+	for _, c := range cases {
+		buildRelations(c.tables, "app")
+		for _, tb := range c.tables {
+			want, ok := c.want[tb.Name]
+			if !ok {
+				continue
+			}
+			if got := relations(tb); got != want {
+				t.Errorf("%s: %s: got %q, want %q", c.name, tb.Name, got, want)
+			}
+		}
+	}
+}
+
+func TestJunctionRefs(t *testing.T) {
+	cases := []struct {
+		tb   *Table
+		want string
+	}{
+		{testTable("post_tag", []string{"post_id=post", "tag_id=tag"}), "post,tag"},
+		{testTable("post_tag", []string{"post_id=post", "tag_id=tag"}, "note"), ""},
+		{testTable("post_tag", []string{"post_id=post"}, "tag"), ""},
+		{testTable("friend", []string{"user_id=user", "friend_id=user"}), ""},
+		{compositeTable("post_tag", "post_id=post", "tag_id=tag"), "post,tag"},
+		{compositeTable("post_tag", "post_id=post"), ""},
+	}
+	for _, c := range cases {
+		if got := strings.Join(c.tb.junctionRefs(), ","); got != c.want {
+			t.Errorf("%s %s: got %q, want %q", c.tb.Name, relations(c.tb), got, c.want)
+		}
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	for in, want := range map[string]string{
+		"Post":     "Posts",
+		"Category": "Categories",
+		"Day":      "Days",
+		"News":     "News",
+		"Y":        "Ys",
+	} {
+		if got := pluralize(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"user", "user", true},
+		{"user", "users", false},
+		{"audit_*", "audit_log", true},
+		{"audit_*", "user_audit", false},
+		{"*_log", "audit_log", true},
+		{"user_?", "user_1", true},
+		{"/^audit_/", "audit_log", true},
+		{"/^audit_/", "user_audit", false},
+		{"/_(log|trail)$/", "audit_trail", true},
+		{"/", "/", true},
+	}
+	for _, c := range cases {
+		got, err := matchPattern(c.pattern, c.name)
+		if err != nil {
+			t.Fatalf("%s: %v", c.pattern, err)
+		}
+		if got != c.want {
+			t.Errorf("%s %s: got %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestNewTableFilter(t *testing.T) {
+	for _, bad := range [][3]string{{"user_[", "", ""}, {"", "/audit_(/", ""}, {"", "", "user.[a-"}} {
+		if _, err := newTableFilter(bad[0], bad[1], bad[2]); err == nil {
+			t.Errorf("%q should fail", bad)
+		}
+	}
+	f, err := newTableFilter(" user , post_* ,", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(f.include, ","); got != "user,post_*" {
+		t.Errorf("include: %s", got)
+	}
+}
+
+func TestSelectTables(t *testing.T) {
+	tableNames := []string{"user", "post", "post_tag", "audit_log", "audit_trail"}
+	cases := []struct {
+		include, exclude, want string
+	}{
+		{"", "", "*"},
+		{"user,post", "", "post,user"},
+		{"post*", "", "post,post_tag"},
+		{"", "audit_*", "post,post_tag,user"},
+		{"", "/^audit_|_tag$/", "post,user"},
+		{"post*,audit_*", "*_trail,post_tag", "audit_log,post"},
+		{"nothing", "", ""},
+	}
+	for _, c := range cases {
+		f, err := newTableFilter(c.include, c.exclude, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected := f.selectTables(tableNames)
+		var names []string
+		for _, name := range tableNames {
+			if selected[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		got := strings.Join(names, ",")
+		if selected == nil {
+			got = "*"
+		}
+		if got != c.want {
+			t.Errorf("-tables=%s -exclude=%s: got %s, want %s", c.include, c.exclude, got, c.want)
+		}
+	}
+}
+
+func TestFilterColumns(t *testing.T) {
+	f, err := newTableFilter("", "", "id,*_at,post.title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := testTable("post", nil, "title", "body", "created_at")
+	post.Columns[3].Type = "time.Time"
+	post.ImportTimePkg = true
+	user := testTable("user", nil, "title")
+	f.filterColumns([]*Table{post, user})
+
+	for _, c := range []struct {
+		tb   *Table
+		want string
+	}{{post, "id,body"}, {user, "id,title"}} {
+		var names []string
+		for _, col := range c.tb.Columns {
+			names = append(names, col.Tag.Column)
+		}
+		if got := strings.Join(names, ","); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.tb.Name, got, c.want)
+		}
+	}
+	if post.ImportTimePkg {
+		t.Error("post no longer has a time.Time column")
+	}
+}
+
+func TestTrimTablePrefix(t *testing.T) {
+	defer func(p docValue) { tablePrefix = p }(tablePrefix)
+	tablePrefix = "tbl_, app_"
+
+	for in, want := range map[string]string{
+		"tbl_user_role": "UserRole",
+		"app_post":      "Post",
+		"app_tbl_post":  "TblPost",
+		"tbl_":          "Tbl",
+		"post":          "Post",
+		"my_tbl_post":   "MyTblPost",
+	} {
+		if got := modelName(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+// fakeTransformer serves tables from memory, one per name, with foreign keys
+// to the tables given by refs. The tables of composite have a composite
+// primary key, which the transformers blacklist. It records the tables it
+// is asked about.
+type fakeTransformer struct {
+	refs      map[string][]string
+	composite map[string]bool
+	read      []string
+}
+
+func (*fakeTransformer) GetTableNames(db *sql.DB) []string { return nil }
+
+func (ft *fakeTransformer) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
+	ft.read = append(ft.read, table.Name)
+	table.Pk = "id"
+	if ft.composite[table.Name] {
+		table.Pk = ""
+		blackList[table.Name] = true
+	}
+	for _, ref := range ft.refs[table.Name] {
+		table.Fk[ref+"_id"] = &ForeignKey{Name: ref + "_id", RefTable: ref, RefColumn: "id"}
+	}
+}
+
+func (ft *fakeTransformer) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+	table.Columns = append(table.Columns, &Column{Name: "Id", Type: "int", Tag: &OrmTag{Column: "id"}})
+	for _, ref := range ft.refs[table.Name] {
+		col := &Column{Name: camelCase(ref), Type: "*" + camelCase(ref), Tag: &OrmTag{Column: ref + "_id", RelFk: true}}
+		if blackList[ref] {
+			col.Name, col.Type, col.Tag.RelFk = camelCase(ref+"_id"), "int", false
+		}
+		table.Columns = append(table.Columns, col)
+	}
+}
+
+func (*fakeTransformer) GetGoDataType(sqlType string) string { return sqlType }
+
+func TestGetTableObjects(t *testing.T) {
+	defer func(p docValue) { tablePrefix = p }(tablePrefix)
+	refs := map[string][]string{"post": {"user"}, "comment": {"post", "audit"}, "audit": {"user"}}
+	tableNames := []string{"user", "post", "comment", "audit"}
+
+	// every table, audit has a composite primary key
+	trans := &fakeTransformer{refs: refs, composite: map[string]bool{"audit": true}}
+	tables, err := getTableObjects(tableNames, nil, nil, trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(trans.read, ","); len(tables) != 4 || got != "user,post,comment,audit" {
+		t.Fatalf("got %d tables, read %s", len(tables), got)
+	}
+	// the columns are read once every table is known, so the foreign key
+	// to audit stays a plain column although comment comes first
+	if col := tables[2].Columns[2]; col.Type != "int" || col.Tag.RelFk {
+		t.Errorf("comment.audit_id should be a plain column, got %s %s", col.Name, col.Type)
+	}
+
+	// the tables left out are neither read nor referenced
+	trans = &fakeTransformer{refs: refs}
+	tables, err = getTableObjects(tableNames, map[string]bool{"post": true, "comment": true}, nil, trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(trans.read, ","); got != "post,comment" {
+		t.Fatalf("read %s, want post and comment", got)
+	}
+	if col := tables[0].Columns[1]; col.Type != "int" || col.Tag.RelFk {
+		t.Errorf("post.user_id should be a plain column, got %s %s", col.Name, col.Type)
+	}
+	if col := tables[1].Columns[1]; col.Type != "*Post" || !col.Tag.RelFk {
+		t.Errorf("comment.post_id should be a relation, got %s %s", col.Name, col.Type)
+	}
+	if col := tables[1].Columns[2]; col.Type != "int" || col.Tag.RelFk {
+		t.Errorf("comment.audit_id should be a plain column, got %s %s", col.Name, col.Type)
+	}
+
+	// app_user and user both become User once app_ is trimmed
+	tablePrefix = "app_"
+	trans = &fakeTransformer{}
+	if _, err := getTableObjects([]string{"app_user", "user"}, nil, nil, trans); err == nil {
+		t.Error("app_user and user should collide")
+	}
+	if _, err := getTableObjects([]string{"app_user", "user"}, map[string]bool{"app_user": true}, nil, trans); err != nil {
+		t.Errorf("user is left out, got %v", err)
+	}
+}
+
+func TestWriteGenFile(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "post_gen.go")
+	for _, content := range []string{"package models\n\nvar a = 1\n", "package models\n\nvar b = 2\n"} {
+		writeGenFile(fpath, content)
+		got, _ := ioutil.ReadFile(fpath)
+		if string(got) != GenHeader+content {
+			t.Errorf("got\n%s\nwant\n%s", got, GenHeader+content)
+		}
+	}
+}
+
+// withStdin runs f with input on the standard input.
+func withStdin(t *testing.T, input string, f func()) {
+	fpath := filepath.Join(t.TempDir(), "stdin")
+	ioutil.WriteFile(fpath, []byte(input), 0644)
+	in, err := os.Open(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	defer func(old *os.File) { os.Stdin = old }(os.Stdin)
+	os.Stdin = in
+	f()
+}
+
+func TestClaimUserFile(t *testing.T) {
+	const decl = "type Post struct"
+	const user = "package models\n"
+	const generated = "package models\n\ntype Post struct {\n}\n"
+	cases := []struct {
+		name, existing, answer string
+		want                   bool
+		content                string
+	}{
+		{"new file", "", "", true, user},
+		{"user file", "package models\n\nfunc (p *Post) Title() string { return \"\" }\n", "", true, "package models\n\nfunc (p *Post) Title() string { return \"\" }\n"},
+		{"generated code kept", generated, "no\n", false, generated},
+		{"generated code replaced", generated, "yes\n", true, user},
+	}
+	for _, c := range cases {
+		fpath := filepath.Join(t.TempDir(), "post.go")
+		if c.existing != "" {
+			ioutil.WriteFile(fpath, []byte(c.existing), 0644)
+		}
+		var ok bool
+		withStdin(t, c.answer, func() { ok = claimUserFile(fpath, decl, user) })
+		if ok != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, ok, c.want)
+		}
+		if got, _ := ioutil.ReadFile(fpath); string(got) != c.content {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, c.content)
+		}
+	}
+}
+
+func TestReplaceGuardedRegion(t *testing.T) {
+	src := "func init() {\n\tbeego.Router(\"/\", &MainController{})\n\t" + GuardBegin + "\n\tns := old\n\t" + GuardEnd + "\n\tbeego.Router(\"/mine\", &MineController{})\n}\n"
+	want := "func init() {\n\tbeego.Router(\"/\", &MainController{})\n\t" + GuardBegin + "\n\tns := new\n\t" + GuardEnd + "\n\tbeego.Router(\"/mine\", &MineController{})\n}\n"
+	got, ok := replaceGuardedRegion(src, "\n\tns := new\n")
+	if !ok || got != want {
+		t.Errorf("got %v\n%s\nwant\n%s", ok, got, want)
+	}
+
+	for _, src := range []string{
+		"func init() {}\n",
+		"// " + GuardEnd + "\n" + GuardBegin + "\n",
+		GuardBegin + "\n",
+	} {
+		if got, ok := replaceGuardedRegion(src, "x"); ok || got != src {
+			t.Errorf("%q: got %v %q, want it unchanged", src, ok, got)
+		}
+	}
+}
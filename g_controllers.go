@@ -54,17 +54,40 @@ func generateController(cname, currpath string) {
 
 		modelPath := path.Join(currpath, "models", strings.ToLower(controllerName)+".go")
 
+		servicePath := path.Join(currpath, "services", p, strings.ToLower(controllerName)+".go")
+
 		var content string
-		if _, err := os.Stat(modelPath); err == nil {
+		data := &ControllerTemplateData{PackageName: packageName, ControllerName: controllerName}
+		if _, err := os.Stat(servicePath); err == nil && layered {
+			ColorLog("[INFO] Using matching service '%sService'\n", controllerName)
+			content = strings.Replace(controllerServiceTpl, "{{packageName}}", packageName, -1)
+			pkgPath := getPackagePath(currpath)
+			content = strings.Replace(content, "{{pkgPath}}", pkgPath, -1)
+			content = strings.Replace(content, "{{servicePkgPath}}", path.Join(pkgPath, "services", p), -1)
+			content = strings.Replace(content, "{{servicePackage}}", servicePackageName(p), -1)
+			data.PkgPath = pkgPath
+			data.HasModel = true
+			data.HasService = true
+		} else if _, err := os.Stat(modelPath); err == nil {
 			ColorLog("[INFO] Using matching model '%s'\n", controllerName)
 			content = strings.Replace(controllerModelTpl, "{{packageName}}", packageName, -1)
 			pkgPath := getPackagePath(currpath)
 			content = strings.Replace(content, "{{pkgPath}}", pkgPath, -1)
+			data.PkgPath = pkgPath
+			data.HasModel = true
 		} else {
 			content = strings.Replace(controllerTpl, "{{packageName}}", packageName, -1)
 		}
 
+		getAll := "models.GetAll{{controllerName}}(q)"
+		if data.HasService {
+			getAll = "{{controllerName}}Service.List(q)"
+		}
+		content = strings.Replace(content, "{{getAllParams}}", getAllParamsTpl, 1)
+		content = strings.Replace(content, "{{getAllAction}}", strings.Replace(getAllActionTpl, "{{getAll}}", getAll, 1), 1)
+		content = strings.Replace(content, "{{decode}}", strings.Replace(decodeTpl, "{{ctrlType}}", "{{controllerName}}Controller", -1), 1)
 		content = strings.Replace(content, "{{controllerName}}", controllerName, -1)
+		content = templateOr("controller.go", data, content)
 		f.WriteString(content)
 
 		// Run 'gofmt' on the generated source code
@@ -74,8 +97,59 @@ func generateController(cname, currpath string) {
 		ColorLog("[ERRO] Could not create controller file: %s\n", err)
 		os.Exit(2)
 	}
+
+	url := registerRoute(cname, currpath)
+
+	// Controllers backed by a model get a test of their endpoints
+	modelPath := path.Join(currpath, "models", strings.ToLower(controllerName)+".go")
+	if isExist(modelPath) {
+		fds, err := modelFields(modelPath, controllerName)
+		if err != nil {
+			ColorLog("[WARN] Could not read the model: %s\n", err)
+		}
+		generateControllerTest(strings.ToLower(controllerName), controllerName, url, getPackagePath(currpath),
+			path.Join(currpath, "tests"), "controller_test.go", fds)
+	}
 }
 
+// decodeTpl holds the methods reading the body of the Post and Put actions
+// of the controllers backed by a model. {{ctrlType}} is the controller type.
+var decodeTpl = `// decode reads the JSON body of the request into v and checks v against
+// the valid tags of its model. If either fails, the request is answered
+// with 400 and false is returned.
+func (c *{{ctrlType}}) decode(v interface{}) bool {
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, v); err != nil {
+		c.Ctx.Output.SetStatus(400)
+		c.Data["json"] = map[string]interface{}{"error": err.Error()}
+		c.ServeJSON()
+		return false
+	}
+	return c.validate(v)
+}
+
+// validate checks v against the valid tags of its model. If it fails, the
+// request is answered with 400 and the failing fields, and false is returned.
+func (c *{{ctrlType}}) validate(v interface{}) bool {
+	valid := validation.Validation{}
+	ok, err := valid.Valid(v)
+	if err == nil && ok {
+		return true
+	}
+	c.Ctx.Output.SetStatus(400)
+	if err != nil {
+		c.Data["json"] = map[string]interface{}{"error": err.Error()}
+	} else {
+		errs := make([]map[string]string, 0, len(valid.Errors))
+		for _, e := range valid.Errors {
+			errs = append(errs, map[string]string{"field": e.Field, "rule": e.Name, "message": e.Message})
+		}
+		c.Data["json"] = map[string]interface{}{"errors": errs}
+	}
+	c.ServeJSON()
+	return false
+}
+`
+
 var controllerTpl = `package {{packageName}}
 
 import (
@@ -121,14 +195,8 @@ func (c *{{controllerName}}Controller) GetOne() {
 // GetAll ...
 // @Title GetAll
 // @Description get {{controllerName}}
-// @Param	query	query	string	false	"Filter. e.g. col1:v1,col2:v2 ..."
-// @Param	fields	query	string	false	"Fields returned. e.g. col1,col2 ..."
-// @Param	sortby	query	string	false	"Sorted-by fields. e.g. col1,col2 ..."
-// @Param	order	query	string	false	"Order corresponding to each sortby field, if single value, apply to all sortby fields. e.g. desc,asc ..."
-// @Param	limit	query	string	false	"Limit the size of result set. Must be an integer"
-// @Param	offset	query	string	false	"Start position of result set. Must be an integer"
-// @Success 200 {object} models.{{controllerName}}
-// @Failure 403
+{{getAllParams}}// @Success 200 {object} models.{{controllerName}}
+// @Failure 400 invalid query
 // @router / [get]
 func (c *{{controllerName}}Controller) GetAll() {
 
@@ -163,11 +231,10 @@ var controllerModelTpl = `package {{packageName}}
 import (
 	"{{pkgPath}}/models"
 	"encoding/json"
-	"errors"
 	"strconv"
-	"strings"
 
 	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/validation"
 )
 
 //  {{controllerName}}Controller oprations for {{controllerName}}
@@ -184,16 +251,20 @@ func (c *{{controllerName}}Controller) URLMapping() {
 	c.Mapping("Delete", c.Delete)
 }
 
+{{decode}}
 // Post ...
 // @Title Post
 // @Description create {{controllerName}}
 // @Param	body		body 	models.{{controllerName}}	true		"body for {{controllerName}} content"
 // @Success 201 {int} models.{{controllerName}}
+// @Failure 400 invalid body or validation failed
 // @Failure 403 body is empty
 // @router / [post]
 func (c *{{controllerName}}Controller) Post() {
 	var v models.{{controllerName}}
-	json.Unmarshal(c.Ctx.Input.RequestBody, &v)
+	if !c.decode(&v) {
+		return
+	}
 	if _, err := models.Add{{controllerName}}(&v); err == nil {
 		c.Ctx.Output.SetStatus(201)
 		c.Data["json"] = v
@@ -225,80 +296,153 @@ func (c *{{controllerName}}Controller) GetOne() {
 // GetAll ...
 // @Title Get All
 // @Description get {{controllerName}}
-// @Param	query	query	string	false	"Filter. e.g. col1:v1,col2:v2 ..."
-// @Param	fields	query	string	false	"Fields returned. e.g. col1,col2 ..."
-// @Param	sortby	query	string	false	"Sorted-by fields. e.g. col1,col2 ..."
-// @Param	order	query	string	false	"Order corresponding to each sortby field, if single value, apply to all sortby fields. e.g. desc,asc ..."
-// @Param	limit	query	string	false	"Limit the size of result set. Must be an integer"
-// @Param	offset	query	string	false	"Start position of result set. Must be an integer"
-// @Success 200 {object} models.{{controllerName}}
-// @Failure 403
+{{getAllParams}}// @Success 200 {object} models.{{controllerName}}
+// @Failure 400 invalid query
 // @router / [get]
 func (c *{{controllerName}}Controller) GetAll() {
-	var fields []string
-	var sortby []string
-	var order []string
-	var query = make(map[string]string)
-	var limit int64 = 10
-	var offset int64
-
-	// fields: col1,col2,entity.col3
-	if v := c.GetString("fields"); v != "" {
-		fields = strings.Split(v, ",")
-	}
-	// limit: 10 (default is 10)
-	if v, err := c.GetInt64("limit"); err == nil {
-		limit = v
+{{getAllAction}}}
+
+// Put ...
+// @Title Put
+// @Description update the {{controllerName}}
+// @Param	id		path 	string	true		"The id you want to update"
+// @Param	body		body 	models.{{controllerName}}	true		"body for {{controllerName}} content"
+// @Success 200 {object} models.{{controllerName}}
+// @Failure 400 invalid body or validation failed
+// @Failure 403 :id is not int
+// @router /:id [put]
+func (c *{{controllerName}}Controller) Put() {
+	idStr := c.Ctx.Input.Param(":id")
+	id, _ := strconv.ParseInt(idStr, 0, 64)
+	v := models.{{controllerName}}{Id: id}
+	if !c.decode(&v) {
+		return
 	}
-	// offset: 0 (default is 0)
-	if v, err := c.GetInt64("offset"); err == nil {
-		offset = v
+	if err := models.Update{{controllerName}}ById(&v); err == nil {
+		c.Data["json"] = "OK"
+	} else {
+		c.Data["json"] = err.Error()
 	}
-	// sortby: col1,col2
-	if v := c.GetString("sortby"); v != "" {
-		sortby = strings.Split(v, ",")
+	c.ServeJSON()
+}
+
+// Delete ...
+// @Title Delete
+// @Description delete the {{controllerName}}
+// @Param	id		path 	string	true		"The id you want to delete"
+// @Success 200 {string} delete success!
+// @Failure 403 id is empty
+// @router /:id [delete]
+func (c *{{controllerName}}Controller) Delete() {
+	idStr := c.Ctx.Input.Param(":id")
+	id, _ := strconv.ParseInt(idStr, 0, 64)
+	if err := models.Delete{{controllerName}}(id); err == nil {
+		c.Data["json"] = "OK"
+	} else {
+		c.Data["json"] = err.Error()
 	}
-	// order: desc,asc
-	if v := c.GetString("order"); v != "" {
-		order = strings.Split(v, ",")
+	c.ServeJSON()
+}
+`
+
+var controllerServiceTpl = `package {{packageName}}
+
+import (
+	"{{pkgPath}}/models"
+	"{{servicePkgPath}}"
+	"encoding/json"
+	"strconv"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/validation"
+)
+
+// {{controllerName}}Service is used by {{controllerName}}Controller. Tests may replace
+// it with a mock implementing {{servicePackage}}.{{controllerName}}Service.
+var {{controllerName}}Service {{servicePackage}}.{{controllerName}}Service = {{servicePackage}}.New{{controllerName}}Service()
+
+// {{controllerName}}Controller operations for {{controllerName}}
+type {{controllerName}}Controller struct {
+	beego.Controller
+}
+
+// URLMapping ...
+func (c *{{controllerName}}Controller) URLMapping() {
+	c.Mapping("Post", c.Post)
+	c.Mapping("GetOne", c.GetOne)
+	c.Mapping("GetAll", c.GetAll)
+	c.Mapping("Put", c.Put)
+	c.Mapping("Delete", c.Delete)
+}
+
+{{decode}}
+// Post ...
+// @Title Post
+// @Description create {{controllerName}}
+// @Param	body		body 	models.{{controllerName}}	true		"body for {{controllerName}} content"
+// @Success 201 {int} models.{{controllerName}}
+// @Failure 400 invalid body or validation failed
+// @Failure 403 body is empty
+// @router / [post]
+func (c *{{controllerName}}Controller) Post() {
+	var v models.{{controllerName}}
+	if !c.decode(&v) {
+		return
 	}
-	// query: k:v,k:v
-	if v := c.GetString("query"); v != "" {
-		for _, cond := range strings.Split(v, ",") {
-			kv := strings.SplitN(cond, ":", 2)
-			if len(kv) != 2 {
-				c.Data["json"] = errors.New("Error: invalid query key/value pair")
-				c.ServeJSON()
-				return
-			}
-			k, v := kv[0], kv[1]
-			query[k] = v
-		}
+	if _, err := {{controllerName}}Service.Create(&v); err == nil {
+		c.Ctx.Output.SetStatus(201)
+		c.Data["json"] = v
+	} else {
+		c.Data["json"] = err.Error()
 	}
+	c.ServeJSON()
+}
 
-	l, err := models.GetAll{{controllerName}}(query, fields, sortby, order, offset, limit)
+// GetOne ...
+// @Title Get One
+// @Description get {{controllerName}} by id
+// @Param	id		path 	string	true		"The key for staticblock"
+// @Success 200 {object} models.{{controllerName}}
+// @Failure 403 :id is empty
+// @router /:id [get]
+func (c *{{controllerName}}Controller) GetOne() {
+	idStr := c.Ctx.Input.Param(":id")
+	id, _ := strconv.ParseInt(idStr, 0, 64)
+	v, err := {{controllerName}}Service.Get(id)
 	if err != nil {
 		c.Data["json"] = err.Error()
 	} else {
-		c.Data["json"] = l
+		c.Data["json"] = v
 	}
 	c.ServeJSON()
 }
 
+// GetAll ...
+// @Title Get All
+// @Description get {{controllerName}}
+{{getAllParams}}// @Success 200 {object} models.{{controllerName}}
+// @Failure 400 invalid query
+// @router / [get]
+func (c *{{controllerName}}Controller) GetAll() {
+{{getAllAction}}}
+
 // Put ...
 // @Title Put
 // @Description update the {{controllerName}}
 // @Param	id		path 	string	true		"The id you want to update"
 // @Param	body		body 	models.{{controllerName}}	true		"body for {{controllerName}} content"
 // @Success 200 {object} models.{{controllerName}}
+// @Failure 400 invalid body or validation failed
 // @Failure 403 :id is not int
 // @router /:id [put]
 func (c *{{controllerName}}Controller) Put() {
 	idStr := c.Ctx.Input.Param(":id")
 	id, _ := strconv.ParseInt(idStr, 0, 64)
 	v := models.{{controllerName}}{Id: id}
-	json.Unmarshal(c.Ctx.Input.RequestBody, &v)
-	if err := models.Update{{controllerName}}ById(&v); err == nil {
+	if !c.decode(&v) {
+		return
+	}
+	if err := {{controllerName}}Service.Update(&v); err == nil {
 		c.Data["json"] = "OK"
 	} else {
 		c.Data["json"] = err.Error()
@@ -316,7 +460,7 @@ func (c *{{controllerName}}Controller) Put() {
 func (c *{{controllerName}}Controller) Delete() {
 	idStr := c.Ctx.Input.Param(":id")
 	id, _ := strconv.ParseInt(idStr, 0, 64)
-	if err := models.Delete{{controllerName}}(id); err == nil {
+	if err := {{controllerName}}Service.Delete(id); err == nil {
 		c.Data["json"] = "OK"
 	} else {
 		c.Data["json"] = err.Error()
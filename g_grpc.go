@@ -0,0 +1,394 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ProtoField is a model field carried by the proto message of a table.
+type ProtoField struct {
+	Name   string // proto field name, e.g. user_id
+	Type   string // proto type, e.g. int64
+	GoName string // field of the message generated by protoc-gen-go, e.g. UserId
+	ToPB   string // statement copying the field from the model m to the message v
+	FromPB string // statement copying the field from the message in to the model m
+}
+
+// protoTypes maps Go data types to proto types and to the Go types
+// protoc-gen-go uses for them.
+var protoTypes = map[string][2]string{
+	"int":       {"int64", "int64"},
+	"int8":      {"int32", "int32"},
+	"int16":     {"int32", "int32"},
+	"int32":     {"int32", "int32"},
+	"int64":     {"int64", "int64"},
+	"uint":      {"uint64", "uint64"},
+	"uint8":     {"uint32", "uint32"},
+	"uint16":    {"uint32", "uint32"},
+	"uint32":    {"uint32", "uint32"},
+	"uint64":    {"uint64", "uint64"},
+	"float32":   {"float", "float32"},
+	"float64":   {"double", "float64"},
+	"string":    {"string", "string"},
+	"bool":      {"bool", "bool"},
+	"time.Time": {"google.protobuf.Timestamp", ""},
+}
+
+// protoFields returns the message fields of tb. Foreign keys are carried
+// as the Id of the referenced record, e.g. user_id; reverse and m2m
+// relations are left out.
+func (tb *Table) protoFields() []ProtoField {
+	var fds []ProtoField
+	for _, col := range tb.Columns {
+		fd := ProtoField{Name: snakeString(col.Name)}
+		fd.GoName = protoGoName(fd.Name)
+		switch {
+		case strings.HasPrefix(col.Type, "[]"):
+			continue
+		case strings.HasPrefix(col.Type, "*"):
+			fd.Type = "int64"
+			fd.ToPB = fmt.Sprintf("if m.%s != nil {\n\t\tv.%s = int64(m.%s.Id)\n\t}", col.Name, fd.GoName, col.Name)
+			fd.FromPB = fmt.Sprintf("if in.%s != 0 {\n\t\tm.%s = &models.%s{Id: int(in.%s)}\n\t}", fd.GoName, col.Name, col.Type[1:], fd.GoName)
+		case col.Type == "time.Time":
+			fd.Type = protoTypes[col.Type][0]
+			fd.ToPB = fmt.Sprintf("v.%s = timestamppb.New(m.%s)", fd.GoName, col.Name)
+			fd.FromPB = fmt.Sprintf("if in.%s != nil {\n\t\tm.%s = in.%s.AsTime()\n\t}", fd.GoName, col.Name, fd.GoName)
+		default:
+			t, ok := protoTypes[col.Type]
+			if !ok {
+				continue
+			}
+			fd.Type = t[0]
+			if t[1] == col.Type {
+				fd.ToPB = fmt.Sprintf("v.%s = m.%s", fd.GoName, col.Name)
+				fd.FromPB = fmt.Sprintf("m.%s = in.%s", col.Name, fd.GoName)
+			} else {
+				fd.ToPB = fmt.Sprintf("v.%s = %s(m.%s)", fd.GoName, t[1], col.Name)
+				fd.FromPB = fmt.Sprintf("m.%s = %s(in.%s)", col.Name, col.Type, fd.GoName)
+			}
+		}
+		fds = append(fds, fd)
+	}
+	return fds
+}
+
+// protoGoName returns the name protoc-gen-go gives to the Go field of a
+// proto field, e.g. user_id => UserId
+func protoGoName(name string) string {
+	var b []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_' && i == 0:
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(name) && isASCIILower(name[i+1]):
+		case c >= '0' && c <= '9':
+			b = append(b, c)
+		default:
+			if isASCIILower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(name) && isASCIILower(name[i+1]); i++ {
+				b = append(b, name[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+func isASCIILower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+// protoPackage returns the proto package of the app at pkgPath,
+// e.g. github.com/me/my-app => my_app
+func protoPackage(pkgPath string) string {
+	return strings.Replace(strings.ToLower(path.Base(pkgPath)), "-", "_", -1)
+}
+
+// writeProtoFiles generates proto/<name>.proto and the grpc server
+// rpc/<name>_gen.go of each table, and pb/pb_gen.go which compiles the
+// proto files with go generate.
+func writeProtoFiles(tables []*Table, apppath string, selectedTables map[string]bool, pkgPath string) {
+	protoPath := path.Join(apppath, "proto")
+	rpcPath := path.Join(apppath, "rpc")
+	pbPath := path.Join(apppath, "pb")
+	for _, dir := range []string{protoPath, rpcPath, pbPath} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			ColorLog("[ERRO] Could not create directory: %s\n", err)
+			os.Exit(2)
+		}
+	}
+	for _, tb := range tables {
+		// if selectedTables map is not nil and this table is not selected, ignore it
+		if selectedTables != nil {
+			if _, selected := selectedTables[tb.Name]; !selected {
+				continue
+			}
+		}
+		if tb.Pk == "" {
+			continue
+		}
+		filename := getFileName(trimTablePrefix(tb.Name))
+		data := tb.templateData(filename, pkgPath)
+		data.ProtoFields = tb.protoFields()
+
+		var messageFields, toPB, fromPB []string
+		importTime := false
+		for i, fd := range data.ProtoFields {
+			messageFields = append(messageFields, fmt.Sprintf("\t%s %s = %d;", fd.Type, fd.Name, i+1))
+			toPB = append(toPB, "\t"+fd.ToPB)
+			fromPB = append(fromPB, "\t"+fd.FromPB)
+			if fd.Type == "google.protobuf.Timestamp" {
+				importTime = true
+			}
+		}
+		protoImports := `import "google/protobuf/empty.proto";` + "\n"
+		goImports := ""
+		if importTime {
+			protoImports += `import "google/protobuf/timestamp.proto";` + "\n"
+			goImports = "\"google.golang.org/protobuf/types/known/timestamppb\"\n"
+		}
+
+		protoStr := strings.Replace(ProtoTPL, "{{protoImports}}", protoImports, 1)
+		protoStr = strings.Replace(protoStr, "{{messageFields}}", strings.Join(messageFields, "\n"), 1)
+		protoStr = strings.Replace(protoStr, "{{protoPackage}}", protoPackage(pkgPath), -1)
+		protoStr = strings.Replace(protoStr, "{{modelName}}", data.ModelName, -1)
+		protoStr = strings.Replace(protoStr, "{{pkgPath}}", pkgPath, -1)
+		protoStr = templateOr("appcode/grpc.proto", data, protoStr)
+		writeGenFile(path.Join(protoPath, filename+".proto"), protoStr)
+
+		serverStr := strings.Replace(GrpcServerTPL, "{{timePkg}}", goImports, 1)
+		serverStr = strings.Replace(serverStr, "{{toPB}}", strings.Join(toPB, "\n"), 1)
+		serverStr = strings.Replace(serverStr, "{{fromPB}}", strings.Join(fromPB, "\n"), 1)
+		serverStr = strings.Replace(serverStr, "{{modelName}}", data.ModelName, -1)
+		serverStr = strings.Replace(serverStr, "{{lowerName}}", strings.ToLower(data.ModelName[:1])+data.ModelName[1:], -1)
+		serverStr = strings.Replace(serverStr, "{{pkgPath}}", pkgPath, -1)
+		serverStr = templateOr("appcode/grpc_server.go", data, serverStr)
+		writeGenFile(path.Join(rpcPath, filename+"_gen.go"), serverStr)
+	}
+
+	// proto files of earlier runs are compiled too
+	files, _ := filepath.Glob(path.Join(protoPath, "*.proto"))
+	var protoFiles []string
+	for _, f := range files {
+		protoFiles = append(protoFiles, "../proto/"+filepath.Base(f))
+	}
+	pbStr := strings.Replace(GrpcPbTPL, "{{protoFiles}}", strings.Join(protoFiles, " "), 1)
+	pbStr = templateOr("appcode/grpc_pb.go", &GrpcTemplateData{PkgPath: pkgPath, ProtoFiles: protoFiles}, pbStr)
+	writeGenFile(path.Join(pbPath, "pb_gen.go"), pbStr)
+	writeGenFile(path.Join(rpcPath, "rpc_gen.go"), strings.Replace(GrpcErrorTPL, "{{pkgPath}}", pkgPath, -1))
+}
+
+// writeGrpcRegisterFile generates rpc/register_gen.go, which registers
+// the servers of the selected tables on a grpc.Server.
+func writeGrpcRegisterFile(tables []*Table, apppath string, selectedTables map[string]bool, pkgPath string) {
+	var services []string
+	var calls []string
+	for _, tb := range tables {
+		// if selectedTables map is not nil and this table is not selected, ignore it
+		if selectedTables != nil {
+			if _, selected := selectedTables[tb.Name]; !selected {
+				continue
+			}
+		}
+		if tb.Pk == "" {
+			continue
+		}
+		services = append(services, modelName(tb.Name))
+		calls = append(calls, fmt.Sprintf("\tpb.Register%sServiceServer(s, &%sServer{})", modelName(tb.Name), modelName(tb.Name)))
+	}
+	registerStr := strings.Replace(GrpcRegisterTPL, "{{registerCalls}}", strings.Join(calls, "\n"), 1)
+	registerStr = strings.Replace(registerStr, "{{pkgPath}}", pkgPath, -1)
+	registerStr = templateOr("appcode/grpc_register.go", &GrpcTemplateData{PkgPath: pkgPath, Services: services}, registerStr)
+	writeGenFile(path.Join(apppath, "rpc", "register_gen.go"), registerStr)
+	ColorLog("[HINT] Run 'go generate ./pb' to compile the proto files, then call rpc.Register on your grpc.Server\n")
+}
+
+const (
+	ProtoTPL = `syntax = "proto3";
+
+package {{protoPackage}};
+
+option go_package = "{{pkgPath}}/pb;pb";
+
+{{protoImports}}
+message {{modelName}} {
+{{messageFields}}
+}
+
+message Get{{modelName}}Request {
+	int64 id = 1;
+}
+
+// List{{modelName}}Request follows the Query contract of the models package.
+message List{{modelName}}Request {
+	map<string, string> filter = 1; // field__op to value, e.g. title__icontains
+	repeated string sort = 2;       // fields sorted on, descending when prefixed with -
+	int64 page = 3;                 // page number, starting at 1
+	int64 per_page = 4;             // page size
+}
+
+message List{{modelName}}Response {
+	repeated {{modelName}} items = 1;
+	int64 total = 2; // number of records matching the filters
+}
+
+message Delete{{modelName}}Request {
+	int64 id = 1;
+}
+
+service {{modelName}}Service {
+	rpc Create({{modelName}}) returns ({{modelName}});
+	rpc Get(Get{{modelName}}Request) returns ({{modelName}});
+	rpc List(List{{modelName}}Request) returns (List{{modelName}}Response);
+	rpc Update({{modelName}}) returns ({{modelName}});
+	rpc Delete(Delete{{modelName}}Request) returns (google.protobuf.Empty);
+}
+`
+
+	GrpcServerTPL = `package rpc
+
+import (
+	"context"
+
+	"{{pkgPath}}/models"
+	"{{pkgPath}}/pb"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+	{{timePkg}}
+)
+
+// {{modelName}}Server implements pb.{{modelName}}ServiceServer with the models package.
+type {{modelName}}Server struct {
+	pb.Unimplemented{{modelName}}ServiceServer
+}
+
+// Create inserts a {{modelName}} and returns it with its Id.
+func (s *{{modelName}}Server) Create(ctx context.Context, in *pb.{{modelName}}) (*pb.{{modelName}}, error) {
+	m := {{lowerName}}FromPB(in)
+	id, err := models.Add{{modelName}}(m)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	m.Id = int(id)
+	return {{lowerName}}ToPB(m), nil
+}
+
+// Get retrieves the {{modelName}} with the given Id.
+func (s *{{modelName}}Server) Get(ctx context.Context, in *pb.Get{{modelName}}Request) (*pb.{{modelName}}, error) {
+	m, err := models.Get{{modelName}}ById(int(in.Id))
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return {{lowerName}}ToPB(m), nil
+}
+
+// List retrieves a page of the {{modelName}}s matching the filters. The
+// filters and the sort are checked against the model by GetAll{{modelName}},
+// unknown fields and operators give InvalidArgument.
+func (s *{{modelName}}Server) List(ctx context.Context, in *pb.List{{modelName}}Request) (*pb.List{{modelName}}Response, error) {
+	q := &models.Query{Filter: in.Filter, Sort: in.Sort, Page: in.Page, PerPage: in.PerPage}
+	l, total, err := models.GetAll{{modelName}}(q)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	out := &pb.List{{modelName}}Response{Total: total}
+	for _, v := range l {
+		m := v.(models.{{modelName}})
+		out.Items = append(out.Items, {{lowerName}}ToPB(&m))
+	}
+	return out, nil
+}
+
+// Update updates the {{modelName}} by its Id.
+func (s *{{modelName}}Server) Update(ctx context.Context, in *pb.{{modelName}}) (*pb.{{modelName}}, error) {
+	m := {{lowerName}}FromPB(in)
+	if err := models.Update{{modelName}}ById(m); err != nil {
+		return nil, rpcError(err)
+	}
+	return {{lowerName}}ToPB(m), nil
+}
+
+// Delete deletes the {{modelName}} with the given Id.
+func (s *{{modelName}}Server) Delete(ctx context.Context, in *pb.Delete{{modelName}}Request) (*emptypb.Empty, error) {
+	if err := models.Delete{{modelName}}(int(in.Id)); err != nil {
+		return nil, rpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func {{lowerName}}ToPB(m *models.{{modelName}}) *pb.{{modelName}} {
+	v := new(pb.{{modelName}})
+{{toPB}}
+	return v
+}
+
+func {{lowerName}}FromPB(in *pb.{{modelName}}) *models.{{modelName}} {
+	m := new(models.{{modelName}})
+{{fromPB}}
+	return m
+}
+`
+
+	GrpcErrorTPL = `package rpc
+
+import (
+	"{{pkgPath}}/models"
+
+	"github.com/astaxie/beego/orm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rpcError turns an error of the models package into a grpc status.
+func rpcError(err error) error {
+	if err == orm.ErrNoRows {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if _, ok := err.(models.QueryError); ok {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+`
+
+	GrpcRegisterTPL = `package rpc
+
+import (
+	"{{pkgPath}}/pb"
+
+	"google.golang.org/grpc"
+)
+
+// Register registers the generated servers on s.
+func Register(s *grpc.Server) {
+{{registerCalls}}
+}
+`
+
+	GrpcPbTPL = `// Package pb holds the code protoc generates from the files in proto.
+// It needs protoc with the protoc-gen-go and protoc-gen-go-grpc plugins.
+package pb
+
+//go:generate protoc -I ../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative {{protoFiles}}
+`
+)
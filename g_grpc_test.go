@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProtoGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"id":         "Id",
+		"user_id":    "UserId",
+		"created_at": "CreatedAt",
+		"_hidden":    "XHidden",
+		"address2":   "Address2",
+		"line2_text": "Line2Text",
+		"page1a":     "Page1A",
+		"a_1b":       "A_1B",
+		"ip_v4":      "IpV4",
+	} {
+		if got := protoGoName(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestProtoFields(t *testing.T) {
+	tb := &Table{Name: "post", Columns: []*Column{
+		{Name: "Id", Type: "int"},
+		{Name: "Title", Type: "string"},
+		{Name: "Score", Type: "float32"},
+		{Name: "Views", Type: "uint16"},
+		{Name: "Author", Type: "*User"},
+		{Name: "CreatedAt", Type: "time.Time"},
+		{Name: "Tags", Type: "[]*Tag"},
+		{Name: "Data", Type: "[]byte"},
+		{Name: "Extra", Type: "complex64"},
+	}}
+	want := []ProtoField{
+		{"id", "int64", "Id", "v.Id = int64(m.Id)", "m.Id = int(in.Id)"},
+		{"title", "string", "Title", "v.Title = m.Title", "m.Title = in.Title"},
+		{"score", "float", "Score", "v.Score = m.Score", "m.Score = in.Score"},
+		{"views", "uint32", "Views", "v.Views = uint32(m.Views)", "m.Views = uint16(in.Views)"},
+		{"author", "int64", "Author",
+			"if m.Author != nil {\n\t\tv.Author = int64(m.Author.Id)\n\t}",
+			"if in.Author != 0 {\n\t\tm.Author = &models.User{Id: int(in.Author)}\n\t}"},
+		{"created_at", "google.protobuf.Timestamp", "CreatedAt",
+			"v.CreatedAt = timestamppb.New(m.CreatedAt)",
+			"if in.CreatedAt != nil {\n\t\tm.CreatedAt = in.CreatedAt.AsTime()\n\t}"},
+	}
+
+	got := tb.protoFields()
+	if len(got) != len(want) {
+		var names []string
+		for _, fd := range got {
+			names = append(names, fd.Name)
+		}
+		t.Fatalf("got fields %s, want %d fields", strings.Join(names, ","), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("field %d:\ngot  %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
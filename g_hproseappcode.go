@@ -42,12 +42,10 @@ func generateHproseAppcode(driver, connStr, level, tables, currpath string) {
 		ColorLog("[HINT] Level must be either 1, 2 or 3\n")
 		os.Exit(2)
 	}
-	var selectedTables map[string]bool
-	if tables != "" {
-		selectedTables = make(map[string]bool)
-		for _, v := range strings.Split(tables, ",") {
-			selectedTables[v] = true
-		}
+	filter, err := newTableFilter(tables, excludeTables.String(), excludeColumns.String())
+	if err != nil {
+		ColorLog("[ERRO] Invalid table filter: %s\n", err)
+		os.Exit(2)
 	}
 	switch driver {
 	case "mysql":
@@ -60,12 +58,12 @@ func generateHproseAppcode(driver, connStr, level, tables, currpath string) {
 		ColorLog("[HINT] Driver must be one of mysql, postgres or sqlite\n")
 		os.Exit(2)
 	}
-	genHprose(driver, connStr, mode, selectedTables, currpath)
+	genHprose(driver, connStr, mode, filter, currpath)
 }
 
 // Generate takes table, column and foreign key information from database connection
 // and generate corresponding golang source files
-func genHprose(dbms, connStr string, mode byte, selectedTableNames map[string]bool, currpath string) {
+func genHprose(dbms, connStr string, mode byte, filter *tableFilter, currpath string) {
 	db, err := sql.Open(dbms, connStr)
 	if err != nil {
 		ColorLog("[ERRO] Could not connect to %s database: %s, %s\n", dbms, connStr, err)
@@ -75,12 +73,20 @@ func genHprose(dbms, connStr string, mode byte, selectedTableNames map[string]bo
 	if trans, ok := dbDriver[dbms]; ok {
 		ColorLog("[INFO] Analyzing database tables...\n")
 		tableNames := trans.GetTableNames(db)
-		tables := getTableObjects(tableNames, db, trans)
+		selected := filter.selectTables(tableNames)
+		tables, err := getTableObjects(tableNames, selected, db, trans)
+		if err != nil {
+			ColorLog("[ERRO] %s\n", err)
+			ColorLog("[HINT] Leave one of the tables out with -exclude or change -prefix\n")
+			os.Exit(2)
+		}
+		filter.filterColumns(tables)
 		mvcPath := new(MvcPath)
 		mvcPath.ModelPath = path.Join(currpath, "models")
 		createPaths(mode, mvcPath)
 		pkgPath := getPackagePath(currpath)
-		writeHproseSourceFiles(pkgPath, tables, mode, mvcPath, selectedTableNames)
+		buildRelations(tables, pkgPath)
+		writeHproseSourceFiles(pkgPath, tables, mode, mvcPath, selected)
 	} else {
 		ColorLog("[ERRO] Generating app code from %s database is not supported yet.\n", dbms)
 		os.Exit(2)
@@ -100,6 +106,7 @@ func writeHproseSourceFiles(pkgPath string, tables []*Table, mode byte, paths *M
 // writeHproseModelFiles generates model files
 func writeHproseModelFiles(tables []*Table, mPath string, selectedTables map[string]bool) {
 	w := NewColorWriter(os.Stdout)
+	writeQueryFile(mPath, "models")
 
 	for _, tb := range tables {
 		// if selectedTables map is not nil and this table is not selected, ignore it
@@ -108,7 +115,7 @@ func writeHproseModelFiles(tables []*Table, mPath string, selectedTables map[str
 				continue
 			}
 		}
-		filename := getFileName(tb.Name)
+		filename := getFileName(trimTablePrefix(tb.Name))
 		fpath := path.Join(mPath, filename+".go")
 		var f *os.File
 		var err error
@@ -131,15 +138,19 @@ func writeHproseModelFiles(tables []*Table, mPath string, selectedTables map[str
 				continue
 			}
 		}
-		template := ""
+		data := tb.templateData(filename, "")
+		template, templateName := "", ""
 		if tb.Pk == "" {
-			template = HproseStructModelTPL
+			template, templateName = HproseStructModelTPL, "appcode/hprose_struct.go"
 		} else {
-			template = HproseModelTPL
-			hproseAddFunctions = append(hproseAddFunctions, strings.Replace(HproseAddFunction, "{{modelName}}", camelCase(tb.Name), -1))
+			template, templateName = HproseModelTPL, "appcode/hprose_model.go"
+			addFunction := strings.Replace(HproseAddFunction, "{{modelName}}", modelName(tb.Name), -1)
+			hproseAddFunctions = append(hproseAddFunctions, templateOr("appcode/hprose_function.go", data, addFunction))
 		}
-		fileStr := strings.Replace(template, "{{modelStruct}}", tb.String(), 1)
-		fileStr = strings.Replace(fileStr, "{{modelName}}", camelCase(tb.Name), -1)
+		fileStr := strings.Replace(template, "{{getAll}}", hproseGetAllTpl, 1)
+		fileStr = strings.Replace(fileStr, "{{modelStruct}}", tb.String(), 1)
+		fileStr = strings.Replace(fileStr, "{{modelName}}", modelName(tb.Name), -1)
+		fileStr = strings.Replace(fileStr, "{{tableName}}", tb.Name, -1)
 		// if table contains time field, import time.Time package
 		timePkg := ""
 		importTimePkg := ""
@@ -149,6 +160,7 @@ func writeHproseModelFiles(tables []*Table, mPath string, selectedTables map[str
 		}
 		fileStr = strings.Replace(fileStr, "{{timePkg}}", timePkg, -1)
 		fileStr = strings.Replace(fileStr, "{{importTimePkg}}", importTimePkg, -1)
+		fileStr = templateOr(templateName, data, fileStr)
 		if _, err := f.WriteString(fileStr); err != nil {
 			ColorLog("[ERRO] Could not write model file to '%s'\n", fpath)
 			os.Exit(2)
@@ -177,16 +189,18 @@ const (
 	HproseModelTPL = `package models
 
 import (
-	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 	{{timePkg}}
 	"github.com/astaxie/beego/orm"
 )
 
 {{modelStruct}}
 
+func (t *{{modelName}}) TableName() string {
+	return "{{tableName}}"
+}
+
 func init() {
 	orm.RegisterModel(new({{modelName}}))
 }
@@ -210,80 +224,7 @@ func Get{{modelName}}ById(id int) (v *{{modelName}}, err error) {
 	return nil, err
 }
 
-// GetAll{{modelName}} retrieves all {{modelName}} matches certain condition. Returns empty list if
-// no records exist
-func GetAll{{modelName}}(query map[string]string, fields []string, sortby []string, order []string,
-	offset int64, limit int64) (ml []interface{}, err error) {
-	o := orm.NewOrm()
-	qs := o.QueryTable(new({{modelName}}))
-	// query k=v
-	for k, v := range query {
-		// rewrite dot-notation to Object__Attribute
-		k = strings.Replace(k, ".", "__", -1)
-		qs = qs.Filter(k, v)
-	}
-	// order by:
-	var sortFields []string
-	if len(sortby) != 0 {
-		if len(sortby) == len(order) {
-			// 1) for each sort field, there is an associated order
-			for i, v := range sortby {
-				orderby := ""
-				if order[i] == "desc" {
-					orderby = "-" + v
-				} else if order[i] == "asc" {
-					orderby = v
-				} else {
-					return nil, errors.New("Error: Invalid order. Must be either [asc|desc]")
-				}
-				sortFields = append(sortFields, orderby)
-			}
-			qs = qs.OrderBy(sortFields...)
-		} else if len(sortby) != len(order) && len(order) == 1 {
-			// 2) there is exactly one order, all the sorted fields will be sorted by this order
-			for _, v := range sortby {
-				orderby := ""
-				if order[0] == "desc" {
-					orderby = "-" + v
-				} else if order[0] == "asc" {
-					orderby = v
-				} else {
-					return nil, errors.New("Error: Invalid order. Must be either [asc|desc]")
-				}
-				sortFields = append(sortFields, orderby)
-			}
-		} else if len(sortby) != len(order) && len(order) != 1 {
-			return nil, errors.New("Error: 'sortby', 'order' sizes mismatch or 'order' size is not 1")
-		}
-	} else {
-		if len(order) != 0 {
-			return nil, errors.New("Error: unused 'order' fields")
-		}
-	}
-
-	var l []{{modelName}}
-	qs = qs.OrderBy(sortFields...)
-	if _, err = qs.Limit(limit, offset).All(&l, fields...); err == nil {
-		if len(fields) == 0 {
-			for _, v := range l {
-				ml = append(ml, v)
-			}
-		} else {
-			// trim unused fields
-			for _, v := range l {
-				m := make(map[string]interface{})
-				val := reflect.ValueOf(v)
-				for _, fname := range fields {
-					m[fname] = val.FieldByName(fname).Interface()
-				}
-				ml = append(ml, m)
-			}
-		}
-		return ml, nil
-	}
-	return nil, err
-}
-
+{{getAll}}
 // Update{{modelName}} updates {{modelName}} by Id and returns error if
 // the record to be updated doesn't exist
 func Update{{modelName}}ById(m *{{modelName}}) (err error) {
@@ -315,3 +256,15 @@ func Delete{{modelName}}(id int) (err error) {
 }
 `
 )
+
+// hproseGetAllTpl takes the Query as plain arguments, which hprose clients
+// can send without registering a class.
+var hproseGetAllTpl = `// GetAll{{modelName}} retrieves the {{modelName}} records matching filter,
+// e.g. {"title__contains": "beego"}, with the number of records matching it.
+// See Query for the filters, the sort and the pagination.
+func GetAll{{modelName}}(filter map[string]string, fields []string, sort []string,
+	page int64, perPage int64) (ml []interface{}, total int64, err error) {
+	return query{{modelName}}(&Query{Filter: filter, Fields: fields, Sort: sort, Page: page, PerPage: perPage})
+}
+
+` + strings.Replace(getAllTpl, "GetAll{{modelName}}", "query{{modelName}}", -1)
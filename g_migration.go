@@ -18,6 +18,7 @@ import (
 	"fmt" // 格式化i/o
 	"os"	// 系统函数
 	"path" // 斜杠路径操作函数
+	"regexp" // 正则表达式
 	"strings" // 字符串简单操作函数
 	"time"	// 时间函数
 )
@@ -64,7 +65,8 @@ func (m mysqlDriver) generateSQLFromFields(fields string) string {
 			ColorLog("[ERRO] Fields format is wrong. Should be: key:type,key:type " + v + "\n")
 			return ""
 		}
-		typ, tag := m.getSQLType(kv[1])
+		ktype, idx := splitFieldIndex(kv[1])
+		typ, tag := m.getSQLType(ktype)
 		if typ == "" {
 			ColorLog("[ERRO] Fields format is wrong. Should be: key:type,key:type " + v + "\n")
 			return ""
@@ -81,6 +83,9 @@ func (m mysqlDriver) generateSQLFromFields(fields string) string {
 			// Sprintf根据format参数生成格式化的字符串并返回该字符串。
 			tags = tags + fmt.Sprintf(tag, "`"+snakeString(kv[0])+"`") + ","
 		}
+		if idx != "" {
+			ColorLog("[WARN] Indexes are only generated for postgres, add the %s index of '%s' yourself\n", idx, kv[0])
+		}
 	}
 	// func TrimRight(s string, cutset string) string
 	// 返回将s后端所有cutset包含的utf-8码值都去掉的字符串。
@@ -121,15 +126,25 @@ func (m mysqlDriver) getSQLType(ktype string) (tp, tag string) {
 type postgresqlDriver struct{}
 
 func (m postgresqlDriver) generateCreateUp(tableName string) string {
-	upsql := `m.SQL("CREATE TABLE ` + tableName + "(" + m.generateSQLFromFields(fields.String()) + `)");`
+	tableName = snakeString(tableName)
+	upsql := `m.SQL("CREATE TABLE ` + m.quote(tableName) + "(" + m.generateSQLFromFields(fields.String()) + `)");`
+	for _, idx := range m.generateIndexes(tableName, fields.String()) {
+		upsql += "\n\t" + `m.SQL("` + idx + `");`
+	}
 	return upsql
 }
 
 func (m postgresqlDriver) generateCreateDown(tableName string) string {
-	downsql := `m.SQL("DROP TABLE ` + tableName + `")`
+	downsql := `m.SQL("DROP TABLE ` + m.quote(snakeString(tableName)) + `")`
 	return downsql
 }
 
+// quote returns name as a quoted identifier, escaped for use inside
+// the double-quoted string passed to m.SQL.
+func (m postgresqlDriver) quote(name string) string {
+	return `\"` + name + `\"`
+}
+
 func (m postgresqlDriver) generateSQLFromFields(fields string) string {
 	sql, tags := "", ""
 	fds := strings.Split(fields, ",")
@@ -139,53 +154,156 @@ func (m postgresqlDriver) generateSQLFromFields(fields string) string {
 			ColorLog("[ERRO] Fields format is wrong. Should be: key:type,key:type " + v + "\n")
 			return ""
 		}
-		typ, tag := m.getSQLType(kv[1])
+		ktype, _ := splitFieldIndex(kv[1])
+		typ, tag := m.getSQLType(ktype)
 		if typ == "" {
 			ColorLog("[ERRO] Fields format is wrong. Should be: key:type,key:type " + v + "\n")
 			return ""
 		}
-		if i == 0 && strings.ToLower(kv[0]) != "id" {
-			sql += "id serial primary key,"
+		if strings.ToLower(kv[0]) == "id" {
+			typ, tag = m.getIDType(ktype, typ, tag)
 		}
-		sql += snakeString(kv[0]) + " " + typ + ","
+		if i == 0 && !m.hasPrimaryKey(fds) {
+			sql += m.quote("id") + " BIGSERIAL PRIMARY KEY,"
+		}
+		sql += m.quote(snakeString(kv[0])) + " " + typ + ","
 		if tag != "" {
-			tags = tags + fmt.Sprintf(tag, snakeString(kv[0])) + ","
+			tags = tags + fmt.Sprintf(tag, m.quote(snakeString(kv[0]))) + ","
 		}
 	}
-	if tags != "" {
-		sql = strings.TrimRight(sql+" "+tags, ",")
-	} else {
-		sql = strings.TrimRight(sql, ",")
-	}
+	sql = strings.TrimRight(sql+tags, ",")
 	return sql
 }
 
+// hasPrimaryKey reports whether the fields already declare an id column
+// or a primary key, in which case no BIGSERIAL id is added.
+func (m postgresqlDriver) hasPrimaryKey(fds []string) bool {
+	for _, v := range fds {
+		kv := strings.SplitN(v, ":", 2)
+		if strings.ToLower(kv[0]) == "id" {
+			return true
+		}
+		if len(kv) == 2 {
+			ktype, _ := splitFieldIndex(kv[1])
+			if ktype == "auto" || ktype == "pk" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getIDType makes an id field the primary key. Integer ids become serial
+// columns of the matching size; uint64 ids are BIGSERIAL too, so ids above
+// 2^63-1 are not supported.
+func (m postgresqlDriver) getIDType(ktype, typ, tag string) (string, string) {
+	switch ktype {
+	case "auto", "pk":
+		return typ, tag
+	case "int8", "int16", "uint8":
+		return "SMALLSERIAL PRIMARY KEY", ""
+	case "int32", "uint16":
+		return "SERIAL PRIMARY KEY", ""
+	case "int", "int64", "uint", "uint32", "uint64":
+		return "BIGSERIAL PRIMARY KEY", ""
+	}
+	return typ, "PRIMARY KEY (%s)"
+}
+
+// generateIndexes returns a CREATE INDEX statement for every field
+// marked with an ":index" or ":unique" modifier.
+func (m postgresqlDriver) generateIndexes(tableName, fields string) []string {
+	var indexes []string
+	for _, v := range strings.Split(fields, ",") {
+		kv := strings.SplitN(v, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		_, idx := splitFieldIndex(kv[1])
+		if idx == "" {
+			continue
+		}
+		column := snakeString(kv[0])
+		stmt := "CREATE INDEX "
+		if idx == "unique" {
+			stmt = "CREATE UNIQUE INDEX "
+		}
+		name := "idx_" + tableName + "_" + column
+		indexes = append(indexes, stmt+m.quote(name)+" ON "+m.quote(tableName)+" ("+m.quote(column)+")")
+	}
+	return indexes
+}
+
 func (m postgresqlDriver) getSQLType(ktype string) (tp, tag string) {
 	kv := strings.SplitN(ktype, ":", 2)
 	switch kv[0] {
 	case "string":
 		if len(kv) == 2 {
-			return "char(" + kv[1] + ") NOT NULL", ""
+			return "VARCHAR(" + kv[1] + ") NOT NULL", ""
 		}
-		return "TEXT NOT NULL", ""
+		return "VARCHAR(128) NOT NULL", ""
 	case "text":
 		return "TEXT NOT NULL", ""
-	case "auto", "pk":
-		return "serial primary key", ""
+	case "auto":
+		return "BIGSERIAL PRIMARY KEY", ""
+	case "pk":
+		return "BIGINT NOT NULL", "PRIMARY KEY (%s)"
 	case "datetime":
-		return "TIMESTAMP WITHOUT TIME ZONE NOT NULL", ""
-	case "int", "int8", "int16", "int32", "int64":
-		fallthrough
-	case "uint", "uint8", "uint16", "uint32", "uint64":
-		return "integer DEFAULT NULL", ""
+		return "TIMESTAMPTZ NOT NULL", ""
+	case "int8", "int16", "uint8":
+		return "SMALLINT NOT NULL", ""
+	case "int32", "uint16":
+		return "INTEGER NOT NULL", ""
+	case "int", "int64", "uint32":
+		return "BIGINT NOT NULL", ""
+	case "uint", "uint64":
+		// BIGINT is signed, NUMERIC(20) holds every uint64
+		return "NUMERIC(20) NOT NULL", ""
 	case "bool":
-		return "boolean NOT NULL", ""
-	case "float32", "float64", "float":
-		return "numeric NOT NULL", ""
+		return "BOOLEAN NOT NULL", ""
+	case "float32":
+		return "REAL NOT NULL", ""
+	case "float64", "float":
+		return "DOUBLE PRECISION NOT NULL", ""
 	}
 	return "", ""
 }
 
+// splitFieldIndex strips a trailing ":index" or ":unique" modifier from a
+// field type, e.g. "string:64:unique" yields ("string:64", "unique").
+// Validation modifiers are stripped as well, see splitFieldModifiers.
+func splitFieldIndex(ktype string) (string, string) {
+	ktype, idx, _ := splitFieldModifiers(ktype)
+	return ktype, idx
+}
+
+// splitFieldModifiers strips the trailing modifiers of a field type, in any
+// order: ":index" or ":unique", and the validation rules ":required",
+// ":email" and ":range(min..max)". e.g. "string:64:unique:required" yields
+// ("string:64", "unique", ["required"]).
+func splitFieldModifiers(ktype string) (string, string, []string) {
+	idx := ""
+	var rules []string
+	for {
+		i := strings.LastIndex(ktype, ":")
+		if i < 0 {
+			break
+		}
+		mod := ktype[i+1:]
+		if (mod == "index" || mod == "unique") && idx == "" {
+			idx = mod
+		} else if mod == "required" || mod == "email" || fieldRangeRegexp.MatchString(mod) {
+			rules = append([]string{mod}, rules...)
+		} else {
+			break
+		}
+		ktype = ktype[:i]
+	}
+	return ktype, idx, rules
+}
+
+var fieldRangeRegexp = regexp.MustCompile(`^range\((-?\d+)\.\.(-?\d+)\)$`)
+
 func newDBDriver() DBDriver {
 	switch driver {
 	case "mysql":
@@ -244,6 +362,12 @@ func generateMigration(mname, upsql, downsql, curpath string) {
 		content = strings.Replace(content, "{{CurrTime}}", today, -1)
 		content = strings.Replace(content, "{{UpSQL}}", upsql, -1)
 		content = strings.Replace(content, "{{DownSQL}}", downsql, -1)
+		content = templateOr("migration.go", &MigrationTemplateData{
+			StructName: camelCase(mname) + "_" + today,
+			CurrTime:   today,
+			UpSQL:      upsql,
+			DownSQL:    downsql,
+		}, content)
 		f.WriteString(content)
 		// Run 'gofmt' on the generated source code
 		formatSourceCode(fpath)
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files under testdata")
+
+var postgresMigrationTests = []struct {
+	name   string
+	fields string
+}{
+	{"string", "title:string"},
+	{"string_size", "title:string:64"},
+	{"text", "body:text"},
+	{"auto", "id:auto,title:string"},
+	{"pk", "code:pk,title:string"},
+	{"id_int", "id:int,title:string"},
+	{"id_int32", "id:int32,title:string"},
+	{"id_uint64", "id:uint64,title:string"},
+	{"id_string", "id:string:32,title:string"},
+	{"datetime", "published_at:datetime"},
+	{"int", "views:int"},
+	{"int8", "rank:int8"},
+	{"int16", "level:int16"},
+	{"int32", "score:int32"},
+	{"int64", "total:int64"},
+	{"uint", "count:uint"},
+	{"uint8", "flags:uint8"},
+	{"uint16", "port:uint16"},
+	{"uint32", "hits:uint32"},
+	{"uint64", "size:uint64"},
+	{"bool", "active:bool"},
+	{"float32", "ratio:float32"},
+	{"float64", "price:float64"},
+	{"float", "weight:float"},
+	{"index", "email:string:index"},
+	{"unique", "email:string:64:unique"},
+	{"rules", "email:string:64:required:unique:email,age:int:range(0..150)"},
+}
+
+func TestPostgresMigration(t *testing.T) {
+	for _, tt := range postgresMigrationTests {
+		fields = docValue(tt.fields)
+		m := postgresqlDriver{}
+		got := m.generateCreateUp("BlogPost") + "\n" + m.generateCreateDown("BlogPost") + "\n"
+
+		golden := filepath.Join("testdata", "migration", "postgres", tt.name+".golden")
+		if *updateGolden {
+			if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+	fields = ""
+}
+
+func TestValidRules(t *testing.T) {
+	cases := []struct {
+		kind, size string
+		rules      []string
+		want       string
+		fail       bool
+	}{
+		{"string", "64", []string{"required", "email"}, "Required;Email;MaxSize(64)", false},
+		{"string", "", nil, "MaxSize(128)", false},
+		{"text", "", []string{"email"}, "Email", false},
+		{"bool", "", []string{"required"}, "Required", false},
+		{"int", "", []string{"range(0..150)"}, "Range(0,150)", false},
+		{"int64", "", []string{"required", "range(-5..5)"}, "Required;Range(-5,5)", false},
+		{"uint", "", []string{"range(0..150)"}, "", true},
+		{"float", "", []string{"range(0..1)"}, "", true},
+		{"int", "", []string{"email"}, "", true},
+	}
+	for _, c := range cases {
+		got, err := validRules(c.kind, c.size, c.rules)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s %v should fail, got %s", c.kind, c.rules, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("%s %v: got %q, %v, want %q", c.kind, c.rules, got, err, c.want)
+		}
+	}
+}
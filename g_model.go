@@ -54,7 +54,9 @@ func generateModel(mname, fields, currpath string) {
 	fpath := path.Join(fp, strings.ToLower(modelName)+".go")
 	if f, err := os.OpenFile(fpath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err == nil {
 		defer CloseFile(f)
-		content := strings.Replace(modelTpl, "{{packageName}}", packageName, -1)
+		writeQueryFile(fp, packageName)
+		content := strings.Replace(modelTpl, "{{getAll}}", getAllTpl, 1)
+		content = strings.Replace(content, "{{packageName}}", packageName, -1)
 		content = strings.Replace(content, "{{modelName}}", modelName, -1)
 		content = strings.Replace(content, "{{modelStruct}}", modelStruct, -1)
 		if hastime {
@@ -62,6 +64,14 @@ func generateModel(mname, fields, currpath string) {
 		} else {
 			content = strings.Replace(content, "{{timePkg}}", "", -1)
 		}
+		fds, _ := parseFields(fields)
+		content = templateOr("model.go", &ModelTemplateData{
+			PackageName: packageName,
+			ModelName:   modelName,
+			ModelStruct: modelStruct,
+			ImportTime:  hastime,
+			Fields:      fds,
+		}, content)
 		f.WriteString(content)
 		// Run 'gofmt' on the generated source code
 		formatSourceCode(fpath)
@@ -73,35 +83,115 @@ func generateModel(mname, fields, currpath string) {
 }
 
 func getStruct(structname, fields string) (string, bool, error) {
-	if fields == "" {
-		return "", false, errors.New("fields cannot be empty")
+	fds, err := parseFields(fields)
+	if err != nil {
+		return "", false, err
 	}
 
 	hastime := false
 	structStr := "type " + structname + " struct{\n"
-	fds := strings.Split(fields, ",")
-	for i, v := range fds {
+	for i, fd := range fds {
+		if i == 0 && strings.ToLower(fd.Name) != "id" {
+			structStr = structStr + "Id     int64     `orm:\"auto\"`\n"
+		}
+
+		if fd.Type == "time.Time" {
+			hastime = true
+		}
+		structStr = structStr + fd.Name + "       " + fd.Type + "     " + fd.Tag + "\n"
+	}
+	structStr += "}\n"
+	return structStr, hastime, nil
+}
+
+// parseFields parses a -fields list, e.g. title:string:64:index,body:text
+func parseFields(fields string) ([]TemplateField, error) {
+	if fields == "" {
+		return nil, errors.New("fields cannot be empty")
+	}
+
+	var fds []TemplateField
+	for _, v := range strings.Split(fields, ",") {
 		kv := strings.SplitN(v, ":", 2)
 		if len(kv) != 2 {
-			return "", false, errors.New("the fields format is wrong. Should be key:type,key:type " + v)
+			return nil, errors.New("the fields format is wrong. Should be key:type,key:type " + v)
 		}
 
-		typ, tag, hastimeinner := getType(kv[1])
+		ktype, idx, rules := splitFieldModifiers(kv[1])
+		typ, tag, _ := getType(ktype)
 		if typ == "" {
-			return "", false, errors.New("the fields format is wrong. Should be key:type,key:type " + v)
+			return nil, errors.New("the fields format is wrong. Should be key:type,key:type " + v)
+		}
+		if idx != "" {
+			if tag == "" {
+				tag = "`orm:\"" + idx + "\"`"
+			} else {
+				tag = strings.Replace(tag, "`orm:\"", "`orm:\""+idx+";", 1)
+			}
 		}
 
-		if i == 0 && strings.ToLower(kv[0]) != "id" {
-			structStr = structStr + "Id     int64     `orm:\"auto\"`\n"
+		fd := TemplateField{
+			Name:   camelString(kv[0]),
+			Column: snakeString(kv[0]),
+			Index:  idx,
+			Type:   typ,
 		}
+		tv := strings.SplitN(ktype, ":", 2)
+		fd.Kind = tv[0]
+		if len(tv) == 2 {
+			fd.Size = tv[1]
+		}
+		valid, err := validRules(fd.Kind, fd.Size, rules)
+		if err != nil {
+			return nil, errors.New("the field " + kv[0] + " is wrong: " + err.Error())
+		}
+		fd.Valid = valid
+		if fd.Valid != "" {
+			if tag == "" {
+				tag = "`valid:\"" + fd.Valid + "\"`"
+			} else {
+				tag = strings.TrimSuffix(tag, "`") + " valid:\"" + fd.Valid + "\"`"
+			}
+		}
+		fd.Tag = tag
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
 
-		if hastimeinner {
-			hastime = true
+// validRules returns the beego validation rules of a field, e.g.
+// Required;MaxSize(64). Strings with a size get a MaxSize rule. Email is
+// only checked on strings and Range on signed integers, the only kinds the
+// beego validators accept.
+func validRules(kind, size string, rules []string) (string, error) {
+	var valid []string
+	for _, r := range rules {
+		switch r {
+		case "required":
+			valid = append(valid, "Required")
+		case "email":
+			if kind != "string" && kind != "text" {
+				return "", fmt.Errorf("email cannot validate a %s field", kind)
+			}
+			valid = append(valid, "Email")
+		default:
+			if m := fieldRangeRegexp.FindStringSubmatch(r); m != nil {
+				switch kind {
+				case "int", "int8", "int16", "int32", "int64":
+				default:
+					return "", fmt.Errorf("%s cannot validate a %s field, only signed integers", r, kind)
+				}
+				valid = append(valid, "Range("+m[1]+","+m[2]+")")
+			}
 		}
-		structStr = structStr + camelString(kv[0]) + "       " + typ + "     " + tag + "\n"
 	}
-	structStr += "}\n"
-	return structStr, hastime, nil
+	if kind == "string" {
+		if size == "" {
+			size = "128"
+		}
+		valid = append(valid, "MaxSize("+size+")")
+	}
+	return strings.Join(valid, ";"), nil
 }
 
 // fields support type
@@ -139,10 +229,8 @@ func getType(ktype string) (kt, tag string, hasTime bool) {
 var modelTpl = `package {{packageName}}
 
 import (
-	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 	{{timePkg}}
 	"github.com/astaxie/beego/orm"
 )
@@ -172,80 +260,7 @@ func Get{{modelName}}ById(id int64) (v *{{modelName}}, err error) {
 	return nil, err
 }
 
-// GetAll{{modelName}} retrieves all {{modelName}} matches certain condition. Returns empty list if
-// no records exist
-func GetAll{{modelName}}(query map[string]string, fields []string, sortby []string, order []string,
-	offset int64, limit int64) (ml []interface{}, err error) {
-	o := orm.NewOrm()
-	qs := o.QueryTable(new({{modelName}}))
-	// query k=v
-	for k, v := range query {
-		// rewrite dot-notation to Object__Attribute
-		k = strings.Replace(k, ".", "__", -1)
-		qs = qs.Filter(k, v)
-	}
-	// order by:
-	var sortFields []string
-	if len(sortby) != 0 {
-		if len(sortby) == len(order) {
-			// 1) for each sort field, there is an associated order
-			for i, v := range sortby {
-				orderby := ""
-				if order[i] == "desc" {
-					orderby = "-" + v
-				} else if order[i] == "asc" {
-					orderby = v
-				} else {
-					return nil, errors.New("Error: Invalid order. Must be either [asc|desc]")
-				}
-				sortFields = append(sortFields, orderby)
-			}
-			qs = qs.OrderBy(sortFields...)
-		} else if len(sortby) != len(order) && len(order) == 1 {
-			// 2) there is exactly one order, all the sorted fields will be sorted by this order
-			for _, v := range sortby {
-				orderby := ""
-				if order[0] == "desc" {
-					orderby = "-" + v
-				} else if order[0] == "asc" {
-					orderby = v
-				} else {
-					return nil, errors.New("Error: Invalid order. Must be either [asc|desc]")
-				}
-				sortFields = append(sortFields, orderby)
-			}
-		} else if len(sortby) != len(order) && len(order) != 1 {
-			return nil, errors.New("Error: 'sortby', 'order' sizes mismatch or 'order' size is not 1")
-		}
-	} else {
-		if len(order) != 0 {
-			return nil, errors.New("Error: unused 'order' fields")
-		}
-	}
-
-	var l []{{modelName}}
-	qs = qs.OrderBy(sortFields...)
-	if _, err = qs.Limit(limit, offset).All(&l, fields...); err == nil {
-		if len(fields) == 0 {
-			for _, v := range l {
-				ml = append(ml, v)
-			}
-		} else {
-			// trim unused fields
-			for _, v := range l {
-				m := make(map[string]interface{})
-				val := reflect.ValueOf(v)
-				for _, fname := range fields {
-					m[fname] = val.FieldByName(fname).Interface()
-				}
-				ml = append(ml, m)
-			}
-		}
-		return ml, nil
-	}
-	return nil, err
-}
-
+{{getAll}}
 // Update{{modelName}} updates {{modelName}} by Id and returns error if
 // the record to be updated doesn't exist
 func Update{{modelName}}ById(m *{{modelName}}) (err error) {
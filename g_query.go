@@ -0,0 +1,377 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// writeQueryFile writes query.go into the models directory dir unless it
+// exists. It holds the Query type shared by the GetAll functions of the
+// generated models.
+func writeQueryFile(dir, packageName string) {
+	w := NewColorWriter(os.Stdout)
+
+	fpath := path.Join(dir, "query.go")
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	if err != nil {
+		if !os.IsExist(err) {
+			ColorLog("[ERRO] Could not create query file: %s\n", err)
+			os.Exit(2)
+		}
+		return
+	}
+	defer CloseFile(f)
+	content := strings.Replace(queryTpl, "{{packageName}}", packageName, -1)
+	content = templateOr("query.go", &ModelTemplateData{PackageName: packageName}, content)
+	f.WriteString(content)
+	formatSourceCode(fpath)
+	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+}
+
+// getAllTpl is the GetAll function of the generated models.
+var getAllTpl = `// GetAll{{modelName}} retrieves the {{modelName}} records matching q, see
+// Query, with the number of records matching its filters.
+func GetAll{{modelName}}(q *Query) (ml []interface{}, total int64, err error) {
+	if err = q.Check(new({{modelName}})); err != nil {
+		return nil, 0, err
+	}
+	o := orm.NewOrm()
+	qs, err := q.Apply(o.QueryTable(new({{modelName}})))
+	if err != nil {
+		return nil, 0, err
+	}
+	if total, err = qs.Count(); err != nil {
+		return nil, 0, err
+	}
+
+	var l []{{modelName}}
+	if _, err = qs.Limit(q.Limit(), q.Offset()).All(&l, q.Fields...); err == nil {
+		if len(q.Fields) == 0 {
+			for _, v := range l {
+				ml = append(ml, v)
+			}
+		} else {
+			// trim unused fields
+			for _, v := range l {
+				m := make(map[string]interface{})
+				val := reflect.ValueOf(v)
+				for _, fname := range q.Fields {
+					m[fname] = val.FieldByName(fname).Interface()
+				}
+				ml = append(ml, m)
+			}
+		}
+		return ml, total, nil
+	}
+	return nil, 0, err
+}
+`
+
+// getAllParamsTpl documents the Query contract in the @Param annotations
+// of the GetAll controller actions.
+var getAllParamsTpl = `// @Param	filter[field][op]	query	string	false	"Filter on a field, op is eq (the default), ne, gt, gte, lt, lte, contains, icontains, startswith, endswith, in (comma separated) or isnull. e.g. filter[title][contains]=beego"
+// @Param	fields	query	string	false	"Fields returned, named as in the model struct. e.g. Title,Body ..."
+// @Param	sort	query	string	false	"Sorted-by fields, descending when prefixed with -. e.g. -col1,col2 ..."
+// @Param	page	query	int	false	"Page number, starting at 1"
+// @Param	per_page	query	int	false	"Page size, 10 by default and at most 100. The total is returned in the X-Total-Count header"
+`
+
+// getAllActionTpl is the body of the GetAll controller actions. {{getAll}}
+// is the call returning the records, e.g. models.GetAllPost(q).
+var getAllActionTpl = `	q, err := models.ParseQuery(c.Input())
+	if err != nil {
+		c.Ctx.Output.SetStatus(400)
+		c.Data["json"] = map[string]interface{}{"error": err.Error()}
+		c.ServeJSON()
+		return
+	}
+
+	l, total, err := {{getAll}}
+	if _, ok := err.(models.QueryError); ok {
+		c.Ctx.Output.SetStatus(400)
+		c.Data["json"] = map[string]interface{}{"error": err.Error()}
+	} else if err != nil {
+		c.Data["json"] = err.Error()
+	} else {
+		c.Ctx.Output.Header("X-Total-Count", strconv.FormatInt(total, 10))
+		c.Ctx.Output.Header("X-Page", strconv.FormatInt(q.Page, 10))
+		c.Ctx.Output.Header("X-Per-Page", strconv.FormatInt(q.Limit(), 10))
+		c.Data["json"] = l
+	}
+	c.ServeJSON()
+`
+
+var queryTpl = `package {{packageName}}
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+)
+
+const (
+	// DefaultPerPage is the page size when none is given.
+	DefaultPerPage int64 = 10
+	// MaxPerPage is the largest page size accepted.
+	MaxPerPage int64 = 100
+)
+
+// Query is the filtering, sorting and pagination contract of the GetAll
+// functions. Over HTTP, ParseQuery reads it from:
+//
+//   filter[field][op]=value  op is one of the keys of filterOps, eq if
+//                            omitted; field may follow relations, e.g. user.name
+//   fields=A,B               fields returned, named as in the model struct
+//   sort=-a,b                fields sorted on, descending when prefixed with -
+//   page=1                   page number, starting at 1
+//   per_page=10              page size, at most MaxPerPage
+type Query struct {
+	Filter  map[string]string // field__op to value, e.g. user__name__icontains
+	Fields  []string
+	Sort    []string
+	Page    int64
+	PerPage int64
+}
+
+// QueryError reports a Query that does not fit the model, e.g. a filter on
+// a field the model does not have.
+type QueryError string
+
+func (e QueryError) Error() string {
+	return string(e)
+}
+
+// filterOps maps the operators of filter[field][op] to orm operators.
+var filterOps = map[string]string{
+	"eq":         "exact",
+	"ne":         "exact",
+	"gt":         "gt",
+	"gte":        "gte",
+	"lt":         "lt",
+	"lte":        "lte",
+	"contains":   "contains",
+	"icontains":  "icontains",
+	"startswith": "startswith",
+	"endswith":   "endswith",
+	"in":         "in",
+	"isnull":     "isnull",
+}
+
+var (
+	filterKeyRegexp = regexp.MustCompile(` + "`" + `^filter\[([A-Za-z0-9_.]+)\](?:\[([a-z]+)\])?$` + "`" + `)
+	fieldRegexp     = regexp.MustCompile(` + "`" + `^-?[A-Za-z0-9_.]+$` + "`" + `)
+	columnRegexp    = regexp.MustCompile(` + "`" + `column\(([^)]+)\)` + "`" + `)
+)
+
+// ParseQuery reads a Query from the parameters of a request.
+func ParseQuery(values url.Values) (*Query, error) {
+	q := &Query{Filter: make(map[string]string), Page: 1, PerPage: DefaultPerPage}
+	for k, v := range values {
+		if !strings.HasPrefix(k, "filter[") {
+			continue
+		}
+		m := filterKeyRegexp.FindStringSubmatch(k)
+		if m == nil {
+			return nil, QueryError("invalid filter " + k)
+		}
+		op := m[2]
+		if op == "" {
+			op = "eq"
+		}
+		if _, ok := filterOps[op]; !ok {
+			return nil, QueryError("invalid filter operator " + op)
+		}
+		q.Filter[strings.Replace(m[1], ".", "__", -1)+"__"+op] = v[0]
+	}
+	if v := values.Get("fields"); v != "" {
+		q.Fields = strings.Split(v, ",")
+	}
+	if v := values.Get("sort"); v != "" {
+		q.Sort = strings.Split(v, ",")
+	}
+	for _, f := range append(q.Fields, q.Sort...) {
+		if !fieldRegexp.MatchString(f) {
+			return nil, QueryError("invalid field " + f)
+		}
+	}
+	if v := values.Get("page"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return nil, QueryError("invalid page " + v)
+		}
+		q.Page = n
+	}
+	if v := values.Get("per_page"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > MaxPerPage {
+			return nil, QueryError("invalid per_page " + v)
+		}
+		q.PerPage = n
+	}
+	return q, nil
+}
+
+// Limit returns the page size.
+func (q *Query) Limit() int64 {
+	if q.PerPage < 1 {
+		return DefaultPerPage
+	}
+	if q.PerPage > MaxPerPage {
+		return MaxPerPage
+	}
+	return q.PerPage
+}
+
+// Offset returns the position of the first record of the page.
+func (q *Query) Offset() int64 {
+	if q.Page < 1 {
+		return 0
+	}
+	return (q.Page - 1) * q.Limit()
+}
+
+// Check returns a QueryError if q names a field model does not have, model
+// being a pointer to a struct. orm panics on such fields. The returned
+// fields are named as in the model struct; filters and sort fields are
+// resolved as orm does, by field name in any case or by column name, and
+// may follow relations.
+func (q *Query) Check(model interface{}) error {
+	t := reflect.TypeOf(model).Elem()
+	for _, f := range q.Fields {
+		if _, ok := t.FieldByName(f); !ok {
+			return QueryError("invalid field " + f)
+		}
+	}
+	var fields []string
+	for k := range q.Filter {
+		i := strings.LastIndex(k, "__")
+		if i < 0 {
+			return QueryError("invalid filter " + k)
+		}
+		if _, ok := filterOps[k[i+2:]]; !ok {
+			return QueryError("invalid filter operator " + k[i+2:])
+		}
+		fields = append(fields, k[:i])
+	}
+	for _, s := range q.Sort {
+		fields = append(fields, strings.Replace(strings.TrimPrefix(s, "-"), ".", "__", -1))
+	}
+	for _, f := range fields {
+		if !hasField(t, strings.Split(f, "__")) {
+			return QueryError("invalid field " + strings.Replace(f, "__", ".", -1))
+		}
+	}
+	return nil
+}
+
+// hasField reports whether the struct type t has the field path[0], whose
+// model has the field path[1], and so on.
+func hasField(t reflect.Type, path []string) bool {
+	for i, name := range path {
+		f, ok := ormField(t, name)
+		if !ok {
+			return false
+		}
+		if i == len(path)-1 {
+			return true
+		}
+		t = f.Type
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+	}
+	return false
+}
+
+// ormField returns the field of t orm knows by name.
+func ormField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("orm")
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		column := columnName(f.Name)
+		if m := columnRegexp.FindStringSubmatch(tag); m != nil {
+			column = m[1]
+		}
+		if strings.EqualFold(f.Name, name) || column == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// columnName returns the column orm maps a field to, e.g. UserId => user_id
+func columnName(name string) string {
+	var b []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if i > 0 && c >= 'A' && c <= 'Z' && strings.TrimLeft(name[:i], "_") != "" {
+			b = append(b, '_')
+		}
+		b = append(b, c)
+	}
+	return strings.ToLower(string(b))
+}
+
+// Apply adds the filters and the order of q to qs.
+func (q *Query) Apply(qs orm.QuerySeter) (orm.QuerySeter, error) {
+	for k, v := range q.Filter {
+		i := strings.LastIndex(k, "__")
+		if i < 0 {
+			return nil, QueryError("invalid filter " + k)
+		}
+		field, op := k[:i], k[i+2:]
+		expr, ok := filterOps[op]
+		if !ok {
+			return nil, QueryError("invalid filter operator " + op)
+		}
+		switch op {
+		case "ne":
+			qs = qs.Exclude(field+"__"+expr, v)
+		case "in":
+			qs = qs.Filter(field+"__"+expr, strings.Split(v, ","))
+		case "isnull":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, QueryError("invalid isnull value " + v)
+			}
+			qs = qs.Filter(field+"__"+expr, b)
+		default:
+			qs = qs.Filter(field+"__"+expr, v)
+		}
+	}
+	if len(q.Sort) > 0 {
+		order := make([]string, len(q.Sort))
+		for i, s := range q.Sort {
+			order[i] = strings.Replace(s, ".", "__", -1)
+		}
+		qs = qs.OrderBy(order...)
+	}
+	return qs, nil
+}
+`
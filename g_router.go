@@ -0,0 +1,293 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// registerRoute adds the controller cname to routers/router.go. The route
+// goes into the first beego.NewNamespace of the file as an NSNamespace, or
+// becomes a beego.Router call at the end of init if there is no namespace.
+// If the file cannot be updated, the user is told to do it by hand. It
+// returns the URL of the controller, e.g. /v1/post.
+func registerRoute(cname, currpath string) string {
+	w := NewColorWriter(os.Stdout)
+
+	p, f := path.Split(cname)
+	controllerName := strings.Title(f)
+	ctrlPkgPath := path.Join(getPackagePath(currpath), "controllers", p)
+	fpath := path.Join(currpath, "routers", "router.go")
+	hint := func() {
+		ColorLog("[HINT] Add beego.Router(\"/%v\", &controllers.%vController{}) to routers/router.go\n", cname, controllerName)
+	}
+
+	route := "/" + cname
+	src, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		ColorLog("[WARN] Could not read the routers file: %s\n", err)
+		hint()
+		return route
+	}
+	out, changed, err := addRoute(src, route, ctrlPkgPath, controllerName+"Controller")
+	if err != nil {
+		ColorLog("[WARN] Could not register the route of '%s': %s\n", controllerName, err)
+		hint()
+		return route
+	}
+	url := namespacePrefix(src) + route
+	if !changed {
+		ColorLog("[INFO] '%sController' is already registered in '%s'\n", controllerName, fpath)
+		return url
+	}
+	if err := ioutil.WriteFile(fpath, out, 0644); err != nil {
+		ColorLog("[ERRO] Could not write the routers file: %s\n", err)
+		os.Exit(2)
+	}
+	fmt.Fprintf(w, "\t%s%supdate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+	return url
+}
+
+// namespacePrefix returns the prefix of the first beego.NewNamespace in the
+// routers source src, e.g. /v1, or an empty string if there is none.
+func namespacePrefix(src []byte) string {
+	file, err := parser.ParseFile(token.NewFileSet(), "router.go", src, 0)
+	if err != nil {
+		return ""
+	}
+	beegoQual, _ := importName(file, "github.com/astaxie/beego")
+	prefix := ""
+	ast.Inspect(file, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && prefix == "" && isSelector(call.Fun, beegoQual, "NewNamespace") && len(call.Args) > 0 {
+			if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				prefix, _ = strconv.Unquote(lit.Value)
+			}
+		}
+		return prefix == ""
+	})
+	return prefix
+}
+
+// addRoute registers the controller ctrlType of package ctrlPkgPath under
+// route in the routers source src. It reports false if the controller is
+// already registered. The edits are located with go/ast, spliced into the
+// source so that comments are kept, and the result is reprinted with
+// go/printer the way gofmt does.
+func addRoute(src []byte, route, ctrlPkgPath, ctrlType string) ([]byte, bool, error) {
+	return addRoutes(src, route, ctrlPkgPath, ctrlType, nil)
+}
+
+// routeMapping is a beego.Router call mapping the methods of a controller,
+// e.g. "get:GetAll;post:Post", to path.
+type routeMapping struct {
+	path, methods string
+}
+
+// addRoutes is addRoute with explicit mappings of the controller methods.
+// When mappings is nil the controller goes into the first namespace, or is
+// mapped to the CRUD methods under route if there is no namespace.
+func addRoutes(src []byte, route, ctrlPkgPath, ctrlType string, mappings []routeMapping) ([]byte, bool, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "router.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, false, err
+	}
+
+	qual, imported := importName(file, ctrlPkgPath)
+	beegoQual, _ := importName(file, "github.com/astaxie/beego")
+	if imported && isRouteRegistered(file, qual, ctrlType) {
+		return src, false, nil
+	}
+
+	var initFunc *ast.FuncDecl
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "init" {
+			initFunc = fn
+			break
+		}
+	}
+	if initFunc == nil || initFunc.Body == nil {
+		return nil, false, fmt.Errorf("no init function")
+	}
+
+	type edit struct {
+		offset int
+		text   string
+	}
+	var edits []edit
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	ctrl := "&" + qual + "." + ctrlType + "{}"
+
+	var ns *ast.CallExpr
+	ast.Inspect(initFunc.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && ns == nil && isSelector(call.Fun, beegoQual, "NewNamespace") {
+			ns = call
+			return false
+		}
+		return ns == nil
+	})
+	if mappings == nil && ns != nil && len(ns.Args) > 0 {
+		entry := fmt.Sprintf("%s.NSNamespace(%q,\n%s.NSInclude(\n%s,\n),\n)", beegoQual, route, beegoQual, ctrl)
+		last := ns.Args[len(ns.Args)-1]
+		between := string(src[offset(last.End()):offset(ns.Rparen)])
+		if strings.Contains(between, ",") {
+			edits = append(edits, edit{offset(ns.Rparen), entry + ",\n"})
+		} else {
+			edits = append(edits, edit{offset(last.End()), ",\n" + entry + ",\n"})
+		}
+	} else {
+		if mappings == nil {
+			// Outside a namespace the @router annotations of the CRUD methods
+			// do not apply, so they are mapped explicitly.
+			mappings = []routeMapping{
+				{route, "get:GetAll;post:Post"},
+				{strings.TrimSuffix(route, "/") + "/:id", "get:GetOne;put:Put;delete:Delete"},
+			}
+		}
+		var stmt string
+		for _, m := range mappings {
+			stmt += fmt.Sprintf("%s.Router(%q, %s, %q)\n", beegoQual, m.path, ctrl, m.methods)
+		}
+		edits = append(edits, edit{offset(initFunc.Body.Rbrace), stmt})
+	}
+
+	if !imported {
+		spec := strconv.Quote(ctrlPkgPath)
+		if qual != path.Base(ctrlPkgPath) {
+			spec = qual + " " + spec
+		}
+		if gd := importDecl(file); gd != nil && gd.Lparen.IsValid() {
+			edits = append(edits, edit{offset(gd.Rparen), spec + "\n"})
+		} else if gd != nil {
+			edits = append(edits, edit{offset(gd.Pos()), "import " + spec + "\n"})
+		} else {
+			edits = append(edits, edit{offset(file.Name.End()), "\n\nimport " + spec + "\n"})
+		}
+	}
+
+	// apply from the end so that earlier offsets stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].offset > edits[j].offset })
+	out := string(src)
+	for _, e := range edits {
+		out = out[:e.offset] + e.text + out[e.offset:]
+	}
+	fset = token.NewFileSet()
+	file, err = parser.ParseFile(fset, "router.go", out, parser.ParseComments)
+	if err != nil {
+		return nil, false, err
+	}
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// importName returns the name the file uses for the package importPath and
+// whether it is imported at all. A package that is not imported yet is
+// named after the last element of its path.
+func importName(file *ast.File, importPath string) (string, bool) {
+	for _, spec := range file.Imports {
+		if p, err := strconv.Unquote(spec.Path.Value); err == nil && p == importPath {
+			if spec.Name != nil {
+				return spec.Name.Name, true
+			}
+			return path.Base(importPath), true
+		}
+	}
+	return path.Base(importPath), false
+}
+
+// importDecl returns the first import declaration of file.
+func importDecl(file *ast.File) *ast.GenDecl {
+	for _, decl := range file.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			return gd
+		}
+	}
+	return nil
+}
+
+// isRouteRegistered reports whether &qual.ctrlType{} appears in file.
+func isRouteRegistered(file *ast.File, qual, ctrlType string) bool {
+	found := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.CompositeLit); ok && isSelector(lit.Type, qual, ctrlType) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// isPathRouted reports whether a beego.Router call of the routers source
+// src maps path to a controller other than ctrlType.
+func isPathRouted(src []byte, path, ctrlType string) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "router.go", src, 0)
+	if err != nil {
+		return false
+	}
+	beegoQual, _ := importName(file, "github.com/astaxie/beego")
+	found := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !isSelector(call.Fun, beegoQual, "Router") || len(call.Args) < 2 {
+			return !found
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return !found
+		}
+		if p, _ := strconv.Unquote(lit.Value); p != path {
+			return !found
+		}
+		ctrl, ok := call.Args[1].(*ast.UnaryExpr)
+		if !ok {
+			found = true
+			return false
+		}
+		cl, ok := ctrl.X.(*ast.CompositeLit)
+		if !ok {
+			found = true
+			return false
+		}
+		sel, ok := cl.Type.(*ast.SelectorExpr)
+		found = !ok || sel.Sel.Name != ctrlType
+		return !found
+	})
+	return found
+}
+
+// isSelector reports whether expr is pkg.name.
+func isSelector(expr ast.Expr, pkg, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	return ok && id.Name == pkg
+}
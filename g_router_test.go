@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const namespaceRouter = `// @APIVersion 1.0.0
+package routers
+
+import (
+	"app/controllers"
+
+	"github.com/astaxie/beego"
+)
+
+func init() {
+	ns := beego.NewNamespace("/v1",
+		beego.NSNamespace("/object",
+			beego.NSInclude(
+				&controllers.ObjectController{},
+			),
+		),
+	)
+	beego.AddNamespace(ns)
+}
+`
+
+const plainRouter = `package routers
+
+import (
+	"github.com/astaxie/beego"
+)
+
+func init() {
+	beego.Router("/", &c.MainController{})
+}
+`
+
+func TestAddRouteNamespace(t *testing.T) {
+	out, changed, err := addRoute([]byte(namespaceRouter), "/post", "app/controllers", "PostController")
+	if err != nil || !changed {
+		t.Fatalf("addRoute: changed %v, err %v", changed, err)
+	}
+	want := `		beego.NSNamespace("/post",
+			beego.NSInclude(
+				&controllers.PostController{},
+			),
+		),
+	)`
+	if !strings.Contains(string(out), want) {
+		t.Errorf("namespace entry missing, got\n%s", out)
+	}
+	if !strings.HasPrefix(string(out), "// @APIVersion 1.0.0\n") {
+		t.Errorf("comments were lost, got\n%s", out)
+	}
+
+	_, changed, err = addRoute(out, "/post", "app/controllers", "PostController")
+	if err != nil || changed {
+		t.Errorf("second addRoute: changed %v, err %v", changed, err)
+	}
+}
+
+func TestAddRouteRouter(t *testing.T) {
+	out, changed, err := addRoute([]byte(plainRouter), "/cms/article", "app/controllers/cms", "ArticleController")
+	if err != nil || !changed {
+		t.Fatalf("addRoute: changed %v, err %v", changed, err)
+	}
+	for _, want := range []string{
+		`"app/controllers/cms"`,
+		`beego.Router("/cms/article", &cms.ArticleController{}, "get:GetAll;post:Post")` + "\n",
+		`beego.Router("/cms/article/:id", &cms.ArticleController{}, "get:GetOne;put:Put;delete:Delete")` + "\n}",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("%s missing, got\n%s", want, out)
+		}
+	}
+}
+
+func TestAddRouteRouterOnce(t *testing.T) {
+	out, _, err := addRoute([]byte(plainRouter), "/post", "app/controllers", "PostController")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, changed, err := addRoute(out, "/post", "app/controllers", "PostController")
+	if err != nil || changed {
+		t.Errorf("second addRoute: changed %v, err %v", changed, err)
+	}
+	if n := strings.Count(string(out), "&controllers.PostController{}"); n != 2 {
+		t.Errorf("%d routes to PostController, want 2, got\n%s", n, out)
+	}
+}
+
+func TestAddPageRoutes(t *testing.T) {
+	out, changed, err := addRoutes([]byte(namespaceRouter), "/post", "app/controllers", "PostPageController", pageRoutes("/post"))
+	if err != nil || !changed {
+		t.Fatalf("addRoutes: changed %v, err %v", changed, err)
+	}
+	for _, want := range []string{
+		`beego.Router("/post", &controllers.PostPageController{}, "get:Index;post:Create")`,
+		`beego.Router("/post/new", &controllers.PostPageController{}, "get:New")`,
+		`beego.Router("/post/:id", &controllers.PostPageController{}, "get:Show;post,put:Update;delete:Destroy")`,
+		`beego.Router("/post/:id/edit", &controllers.PostPageController{}, "get:Edit")` + "\n}",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("%s missing, got\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), `NSNamespace("/post"`) {
+		t.Errorf("the pages should not go into the namespace, got\n%s", out)
+	}
+}
+
+func TestIsPathRouted(t *testing.T) {
+	out, _, err := addRoute([]byte(plainRouter), "/post", "app/controllers", "PostController")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPathRouted(out, "/post", "PostPageController") {
+		t.Error("/post is routed to PostController")
+	}
+	if isPathRouted(out, "/post", "PostController") {
+		t.Error("/post is routed to PostController only")
+	}
+	if isPathRouted(out, "/pages/post", "PostPageController") {
+		t.Error("/pages/post is not routed")
+	}
+}
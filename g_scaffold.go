@@ -1,48 +1,197 @@
 package main
 
-import "strings"
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 func generateScaffold(sname, fields, currpath, driver, conn string) {
-	ColorLog("[INFO] Do you want to create a '%v' model? [Yes|No] ", sname)
+	if scaffoldPlan {
+		planScaffold(sname, fields, currpath)
+		return
+	}
 
 	// Generate the model
-	if askForConfirmation() {
+	if scaffoldStep(scaffoldModel, "[INFO] Do you want to create a '%v' model? [Yes|No] ", sname) {
 		generateModel(sname, fields, currpath)
 	}
 
+	// Generate the service
+	if layered {
+		if scaffoldStep(scaffoldService, "[INFO] Do you want to create a '%v' service? [Yes|No] ", sname) {
+			generateService(sname, currpath)
+		}
+	}
+
 	// Generate the controller
-	ColorLog("[INFO] Do you want to create a '%v' controller? [Yes|No] ", sname)
-	if askForConfirmation() {
+	if scaffoldStep(scaffoldController, "[INFO] Do you want to create a '%v' controller? [Yes|No] ", sname) {
 		generateController(sname, currpath)
 	}
 
 	// Generate the views
-	ColorLog("[INFO] Do you want to create views for this '%v' resource? [Yes|No] ", sname)
-	if askForConfirmation() {
+	if scaffoldStep(scaffoldViews, "[INFO] Do you want to create views for this '%v' resource? [Yes|No] ", sname) {
 		generateView(sname, currpath)
 	}
 
 	// Generate a migration
-	ColorLog("[INFO] Do you want to create a '%v' migration and schema for this resource? [Yes|No] ", sname)
-	if askForConfirmation() {
-		upsql := ""
-		downsql := ""
-		if fields != "" {
-			dbMigrator := newDBDriver()
-			upsql = dbMigrator.generateCreateUp(sname)
-			downsql = dbMigrator.generateCreateDown(sname)
-			//todo remove
-			//if driver == "" {
-			//	downsql = strings.Replace(downsql, "`", "", -1)
-			//}
-		}
+	if scaffoldStep(scaffoldMigration, "[INFO] Do you want to create a '%v' migration and schema for this resource? [Yes|No] ", sname) {
+		upsql, downsql := scaffoldSQL(sname, fields)
 		generateMigration(sname, upsql, downsql, currpath)
 	}
 
 	// Run the migration
-	ColorLog("[INFO] Do you want to migrate the database? [Yes|No] ")
-	if askForConfirmation() {
+	if scaffoldStep(scaffoldMigrate, "[INFO] Do you want to migrate the database? [Yes|No] ") {
 		migrateUpdate(currpath, driver, conn)
 	}
-	ColorLog("[INFO] All done! Don't forget to add  beego.Router(\"/%v\" ,&controllers.%vController{}) to routers/route.go\n", sname, strings.Title(sname))
+	ColorLog("[INFO] All done!\n")
+}
+
+// scaffoldInteractive reports whether scaffold should ask before each step,
+// which it does unless -yes or one of the step flags is given.
+func scaffoldInteractive() bool {
+	return !(assumeYes || scaffoldModel || scaffoldService || scaffoldController ||
+		scaffoldViews || scaffoldMigration || scaffoldMigrate)
+}
+
+// scaffoldStep reports whether the step enabled by a flag should run. It
+// asks the question only when scaffold runs interactively.
+func scaffoldStep(enabled bool, question string, args ...interface{}) bool {
+	if !scaffoldInteractive() {
+		return assumeYes || enabled
+	}
+	ColorLog(question, args...)
+	return askForConfirmation()
+}
+
+// scaffoldSQL returns the up and down statements of the scaffold migration.
+func scaffoldSQL(sname, fields string) (upsql, downsql string) {
+	if fields != "" {
+		dbMigrator := newDBDriver()
+		upsql = dbMigrator.generateCreateUp(sname)
+		downsql = dbMigrator.generateCreateDown(sname)
+	}
+	return
+}
+
+// planEntry is a file scaffold would touch: action is create, update, keep
+// for a file the run leaves as it is, or conflict for an existing file the
+// run would stop at.
+type planEntry struct {
+	action, path string
+}
+
+// scaffoldPlanEntries returns the files scaffold would touch, in the order of its
+// steps. Without step flags every step is listed.
+func scaffoldPlanEntries(sname, currpath string) []planEntry {
+	all := scaffoldInteractive()
+	step := func(enabled bool) bool { return all || assumeYes || enabled }
+	var entries []planEntry
+	seen := make(map[string]bool)
+	// create adds a file opened with O_EXCL: an existing one stops the run,
+	// unless keep is set because the generator leaves it alone.
+	create := func(fpath string, keep bool) {
+		switch {
+		case !isExist(fpath):
+			entries = append(entries, planEntry{"create", fpath})
+		case keep:
+			entries = append(entries, planEntry{"keep", fpath})
+		default:
+			entries = append(entries, planEntry{"conflict", fpath})
+		}
+	}
+	router := func() {
+		if rpath := path.Join(currpath, "routers", "router.go"); isExist(rpath) && !seen[rpath] {
+			seen[rpath] = true
+			entries = append(entries, planEntry{"update", rpath})
+		}
+	}
+
+	p, f := path.Split(sname)
+	fname := strings.ToLower(f) + ".go"
+	modelPath := path.Join(currpath, "models", p, fname)
+	withModel := step(scaffoldModel)
+	if withModel {
+		create(modelPath, false)
+		create(path.Join(currpath, "models", p, "query.go"), true)
+	}
+	if layered && step(scaffoldService) {
+		create(path.Join(currpath, "services", p, fname), false)
+	}
+	if step(scaffoldController) {
+		create(path.Join(currpath, "controllers", p, fname), false)
+		router()
+		// the test is written when models/<name>.go exists once the model step ran
+		if (withModel && p == "") || isExist(path.Join(currpath, "models", fname)) {
+			create(path.Join(currpath, "tests", strings.ToLower(f)+"_test.go"), true)
+		}
+	}
+	if step(scaffoldViews) {
+		// the pages get a controller and routes when the model has a Get<Name>ById
+		if withModel || modelIDType(modelPath, strings.Title(f)) != "" {
+			router()
+			create(path.Join(currpath, "controllers", p, strings.ToLower(f)+"_page.go"), false)
+		}
+		for _, v := range []string{"index.tpl", "show.tpl", "create.tpl", "edit.tpl"} {
+			create(path.Join(currpath, "views", sname, v), false)
+		}
+	}
+	if step(scaffoldMigration) {
+		today := time.Now().Format(MDateFormat)
+		create(path.Join(currpath, DBPath, MPath, fmt.Sprintf("%s_%s.go", today, sname)), false)
+	}
+	return entries
+}
+
+// planScaffold prints the files scaffold would touch and the SQL it would
+// run, without writing anything.
+func planScaffold(sname, fields, currpath string) {
+	w := NewColorWriter(os.Stdout)
+
+	ColorLog("[INFO] Scaffold '%s' would do the following, nothing is written:\n", sname)
+	var conflicts []string
+	for _, e := range scaffoldPlanEntries(sname, currpath) {
+		switch e.action {
+		case "keep":
+			fmt.Fprintf(w, "\t%s%sexists%s\t %s (kept)%s\n", "\x1b[33m", "\x1b[1m", "\x1b[21m", e.path, "\x1b[0m")
+		case "conflict":
+			fmt.Fprintf(w, "\t%s%sexists%s\t %s (the run would stop here)%s\n", "\x1b[31m", "\x1b[1m", "\x1b[21m", e.path, "\x1b[0m")
+			conflicts = append(conflicts, e.path)
+		default:
+			fmt.Fprintf(w, "\t%s%s%s%s\t %s%s\n", "\x1b[32m", "\x1b[1m", e.action, "\x1b[21m", e.path, "\x1b[0m")
+		}
+	}
+	upsql, _ := scaffoldSQL(sname, fields)
+	all := scaffoldInteractive()
+	if stmts := migrationStatements(upsql); len(stmts) > 0 && (all || assumeYes || scaffoldMigration) {
+		ColorLog("[INFO] The migration would run:\n")
+		for _, s := range stmts {
+			fmt.Fprintf(w, "\t%s;\n", s)
+		}
+	}
+	if all || assumeYes || scaffoldMigrate {
+		ColorLog("[INFO] The database would be migrated, running the pending migrations\n")
+	}
+	if len(conflicts) > 0 {
+		ColorLog("[ERRO] Scaffold would fail, %s already exists; remove it or leave its step out\n", conflicts[0])
+		os.Exit(2)
+	}
+}
+
+var migrationSQLRegexp = regexp.MustCompile(`m\.SQL\(("(?:[^"\\]|\\.)*")\)`)
+
+// migrationStatements extracts the SQL of the m.SQL calls in a generated
+// migration body.
+func migrationStatements(body string) []string {
+	var stmts []string
+	for _, m := range migrationSQLRegexp.FindAllStringSubmatch(body, -1) {
+		if s, err := strconv.Unquote(m[1]); err == nil {
+			stmts = append(stmts, s)
+		}
+	}
+	return stmts
 }
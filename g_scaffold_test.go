@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// planString returns the entries of the scaffold plan of sname in currpath,
+// one "action path" per line, paths relative to currpath.
+func planString(sname, currpath string) string {
+	var lines []string
+	for _, e := range scaffoldPlanEntries(sname, currpath) {
+		lines = append(lines, e.action+" "+strings.TrimPrefix(e.path, currpath+"/"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestScaffoldPlan(t *testing.T) {
+	defer func(yes, l, v bool) { assumeYes, layered, scaffoldViews = yes, l, v }(assumeYes, layered, scaffoldViews)
+	assumeYes, layered, scaffoldViews = true, false, false
+
+	currpath := t.TempDir()
+	os.MkdirAll(path.Join(currpath, "routers"), 0755)
+	ioutil.WriteFile(path.Join(currpath, "routers", "router.go"), []byte("package routers\n"), 0644)
+
+	want := `create models/post.go
+create models/query.go
+create controllers/post.go
+update routers/router.go
+create tests/post_test.go
+create controllers/post_page.go
+create views/post/index.tpl
+create views/post/show.tpl
+create views/post/create.tpl
+create views/post/edit.tpl`
+	got := planString("post", currpath)
+	i := strings.LastIndex(got, "\n")
+	if got[:i] != want {
+		t.Errorf("got\n%s\nwant\n%s", got[:i], want)
+	}
+	if m := got[i+1:]; !strings.HasPrefix(m, "create "+path.Join(DBPath, MPath)+"/") || !strings.HasSuffix(m, "_post.go") {
+		t.Errorf("got migration %s", m)
+	}
+
+	// views alone: the page controller only comes with a model serving it
+	assumeYes, scaffoldViews = false, true
+	if got, want := planString("post", currpath), "create views/post/index.tpl\ncreate views/post/show.tpl\ncreate views/post/create.tpl\ncreate views/post/edit.tpl"; got != want {
+		t.Errorf("views without a model: got\n%s\nwant\n%s", got, want)
+	}
+	os.MkdirAll(path.Join(currpath, "models"), 0755)
+	ioutil.WriteFile(path.Join(currpath, "models", "post.go"), []byte("package models\n\nfunc GetPostById(id int64) {}\n"), 0644)
+	if got := planString("post", currpath); !strings.HasPrefix(got, "update routers/router.go\ncreate controllers/post_page.go\n") {
+		t.Errorf("views with a model: got\n%s", got)
+	}
+	assumeYes, scaffoldViews = true, false
+
+	ioutil.WriteFile(path.Join(currpath, "models", "query.go"), []byte("package models\n"), 0644)
+	os.MkdirAll(path.Join(currpath, "tests"), 0755)
+	ioutil.WriteFile(path.Join(currpath, "tests", "post_test.go"), []byte("package test\n"), 0644)
+	got = planString("post", currpath)
+	for _, line := range []string{"conflict models/post.go", "keep models/query.go", "keep tests/post_test.go", "create controllers/post.go"} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// generateService writes services/<name>.go: an interface for the resource
+// and an implementation backed by the model functions.
+//
+// article
+// cms/article
+//
+func generateService(sname, currpath string) {
+	w := NewColorWriter(os.Stdout)
+
+	p, f := path.Split(sname)
+	modelName := strings.Title(f)
+	packageName := servicePackageName(p)
+
+	ColorLog("[INFO] Using '%s' as service name\n", modelName+"Service")
+	ColorLog("[INFO] Using '%s' as package name\n", packageName)
+
+	fp := path.Join(currpath, "services", p)
+	if _, err := os.Stat(fp); os.IsNotExist(err) {
+		// Create the service's directory
+		if err := os.MkdirAll(fp, 0777); err != nil {
+			ColorLog("[ERRO] Could not create services directory: %s\n", err)
+			os.Exit(2)
+		}
+	}
+
+	fpath := path.Join(fp, strings.ToLower(modelName)+".go")
+	if f, err := os.OpenFile(fpath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err == nil {
+		defer CloseFile(f)
+		pkgPath := getPackagePath(currpath)
+		content := strings.Replace(serviceTpl, "{{packageName}}", packageName, -1)
+		content = strings.Replace(content, "{{pkgPath}}", pkgPath, -1)
+		content = strings.Replace(content, "{{modelName}}", modelName, -1)
+		content = strings.Replace(content, "{{lowerName}}", strings.ToLower(modelName[:1])+modelName[1:], -1)
+		content = templateOr("service.go", &ControllerTemplateData{
+			PackageName:    packageName,
+			ControllerName: modelName,
+			PkgPath:        pkgPath,
+			HasModel:       true,
+		}, content)
+		f.WriteString(content)
+
+		// Run 'gofmt' on the generated source code
+		formatSourceCode(fpath)
+		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+	} else {
+		ColorLog("[ERRO] Could not create service file: %s\n", err)
+		os.Exit(2)
+	}
+}
+
+// servicePackageName returns the package name of the services in dir p,
+// e.g. cms for cms/article and services for article.
+func servicePackageName(p string) string {
+	if p == "" {
+		return "services"
+	}
+	i := strings.LastIndex(p[:len(p)-1], "/")
+	return p[i+1 : len(p)-1]
+}
+
+var serviceTpl = `package {{packageName}}
+
+import (
+	"{{pkgPath}}/models"
+)
+
+// {{modelName}}Service is the business logic of {{modelName}}. Controllers
+// depend on this interface so that it can be replaced by a mock in tests.
+type {{modelName}}Service interface {
+	Create(m *models.{{modelName}}) (int64, error)
+	Get(id int64) (*models.{{modelName}}, error)
+	List(q *models.Query) ([]interface{}, int64, error)
+	Update(m *models.{{modelName}}) error
+	Delete(id int64) error
+}
+
+// {{lowerName}}Service implements {{modelName}}Service with the models package.
+type {{lowerName}}Service struct{}
+
+// New{{modelName}}Service returns the default {{modelName}}Service.
+func New{{modelName}}Service() {{modelName}}Service {
+	return &{{lowerName}}Service{}
+}
+
+// Create inserts m and returns its Id.
+func (s *{{lowerName}}Service) Create(m *models.{{modelName}}) (int64, error) {
+	return models.Add{{modelName}}(m)
+}
+
+// Get retrieves the {{modelName}} with the given Id.
+func (s *{{lowerName}}Service) Get(id int64) (*models.{{modelName}}, error) {
+	return models.Get{{modelName}}ById(id)
+}
+
+// List retrieves a page of the {{modelName}}s matching q, with the number of
+// {{modelName}}s matching its filters.
+func (s *{{lowerName}}Service) List(q *models.Query) ([]interface{}, int64, error) {
+	return models.GetAll{{modelName}}(q)
+}
+
+// Update updates m by its Id.
+func (s *{{lowerName}}Service) Update(m *models.{{modelName}}) error {
+	return models.Update{{modelName}}ById(m)
+}
+
+// Delete deletes the {{modelName}} with the given Id.
+func (s *{{lowerName}}Service) Delete(id int64) error {
+	return models.Delete{{modelName}}(id)
+}
+`
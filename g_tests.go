@@ -0,0 +1,204 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// generateControllerTest writes tests/<filename>_test.go, which runs the
+// CRUD endpoints of the controller ctrlName served at url. fds give the
+// JSON body posted to the controller. An existing test file is kept.
+func generateControllerTest(filename, ctrlName, url, pkgPath, testsPath, tplName string, fds []TemplateField) {
+	w := NewColorWriter(os.Stdout)
+
+	if err := os.MkdirAll(testsPath, 0777); err != nil {
+		ColorLog("[ERRO] Could not create tests directory: %s\n", err)
+		os.Exit(2)
+	}
+	fpath := path.Join(testsPath, filename+"_test.go")
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	if err != nil {
+		if os.IsExist(err) {
+			ColorLog("[WARN] Skipped create file '%s', it already exists\n", fpath)
+			return
+		}
+		ColorLog("[ERRO] Could not create test file: %s\n", err)
+		os.Exit(2)
+	}
+	defer CloseFile(f)
+
+	data := &TestTemplateData{
+		ControllerName: ctrlName,
+		PkgPath:        pkgPath,
+		URL:            url,
+		PkName:         pkField(fds),
+		Body:           sampleJSON(fds),
+	}
+	content := strings.Replace(controllerTestTpl, "{{pkgPath}}", pkgPath, -1)
+	content = strings.Replace(content, "{{ctrlName}}", ctrlName, -1)
+	content = strings.Replace(content, "{{url}}", url, -1)
+	content = strings.Replace(content, "{{pkName}}", data.PkName, -1)
+	content = strings.Replace(content, "{{body}}", strconv.Quote(data.Body), -1)
+	content = templateOr(tplName, data, content)
+	f.WriteString(content)
+
+	formatSourceCode(fpath)
+	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+}
+
+var (
+	validRangeRegexp   = regexp.MustCompile(`Range\((-?\d+),`)
+	validMaxSizeRegexp = regexp.MustCompile(`MaxSize\((\d+)\)`)
+)
+
+// sampleJSON returns a JSON object with a sample value for each field of a
+// basic type, passing the validation rules of the field. The primary key is
+// left for the database to fill in.
+func sampleJSON(fds []TemplateField) string {
+	var pairs []string
+	for _, fd := range fds {
+		if fd.Name == "Id" || fd.Kind == "auto" {
+			continue
+		}
+		var v string
+		switch fd.Type {
+		case "string":
+			sample := "test " + strings.ToLower(fd.Name)
+			if strings.Contains(fd.Valid, "Email") {
+				sample = "test@example.com"
+			}
+			if m := validMaxSizeRegexp.FindStringSubmatch(fd.Valid); m != nil {
+				if n, _ := strconv.Atoi(m[1]); n < len(sample) {
+					sample = sample[:n]
+				}
+			}
+			v = strconv.Quote(sample)
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+			v = "1"
+			if m := validRangeRegexp.FindStringSubmatch(fd.Valid); m != nil {
+				v = m[1]
+			}
+		case "float32", "float64":
+			v = "1.5"
+		case "bool":
+			v = "true"
+		case "time.Time":
+			v = `"2016-01-02T15:04:05Z"`
+		default:
+			continue
+		}
+		pairs = append(pairs, strconv.Quote(fd.Name)+":"+v)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// columnFields returns the columns of tb as template fields, the primary
+// key being of kind auto or pk.
+func columnFields(tb *Table) []TemplateField {
+	var fds []TemplateField
+	for _, col := range tb.Columns {
+		fd := TemplateField{Name: col.Name, Column: col.Name, Kind: col.Type, Type: col.Type}
+		if col.Tag.Column == tb.Pk {
+			fd.Kind = "pk"
+			if col.Tag.Auto {
+				fd.Kind = "auto"
+			}
+		}
+		if col.Type == "string" && col.Tag.Size != "" {
+			fd.Valid, _ = validRules("string", col.Tag.Size, nil)
+		}
+		fds = append(fds, fd)
+	}
+	return fds
+}
+
+var controllerTestTpl = `package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	_ "{{pkgPath}}/routers"
+
+	"github.com/astaxie/beego"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() {
+	_, file, _, _ := runtime.Caller(1)
+	apppath, _ := filepath.Abs(filepath.Dir(filepath.Join(file, ".."+string(filepath.Separator))))
+	beego.TestBeegoInit(apppath)
+}
+
+// Test{{ctrlName}}Controller runs the CRUD endpoints of {{ctrlName}}Controller
+// against the database of the models, which must be registered with
+// orm.RegisterDataBase as main.go does. The cases run in order: the record
+// created by Post is read, updated and deleted through its {{pkName}}.
+func Test{{ctrlName}}Controller(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"Post", "POST", "{{url}}", {{body}}, 201},
+		{"GetOne", "GET", "{{url}}/:id", "", 200},
+		{"GetAll", "GET", "{{url}}?page=1&per_page=10", "", 200},
+		{"GetAll unknown sort field", "GET", "{{url}}?sort=-nope", "", 400},
+		{"GetAll unknown filter field", "GET", "{{url}}?filter[nope]=1", "", 400},
+		{"Put", "PUT", "{{url}}/:id", {{body}}, 200},
+		{"Delete", "DELETE", "{{url}}/:id", "", 200},
+	}
+
+	id := "0"
+	for _, tc := range cases {
+		r, _ := http.NewRequest(tc.method, strings.Replace(tc.url, ":id", id, 1), strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		beego.BeeApp.Handlers.ServeHTTP(w, r)
+
+		beego.Trace("testing", "Test{{ctrlName}}Controller", tc.name, "Code[%d]\n%s", w.Code, w.Body.String())
+
+		if tc.name == "Post" {
+			var created map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &created); err == nil && created["{{pkName}}"] != nil {
+				id = strings.Trim(string(created["{{pkName}}"]), "\"")
+			}
+		}
+
+		Convey("Subject: Test {{ctrlName}} "+tc.name+" Endpoint\n", t, func() {
+			Convey(fmt.Sprintf("Status Code Should Be %d", tc.code), func() {
+				So(w.Code, ShouldEqual, tc.code)
+			})
+			Convey("The Result Should Not Be Empty", func() {
+				So(w.Body.Len(), ShouldBeGreaterThan, 0)
+			})
+		})
+	}
+}
+`
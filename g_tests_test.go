@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateControllerTest(t *testing.T) {
+	tb := &Table{Name: "country", Pk: "code", Columns: []*Column{
+		{Name: "Code", Type: "string", Tag: &OrmTag{Column: "code", Size: "2"}},
+		{Name: "Name", Type: "string", Tag: &OrmTag{Column: "name"}},
+	}}
+	dir := t.TempDir()
+	generateControllerTest("country", "Country", "/v1/country", "app", dir, "appcode/controller_test.go", columnFields(tb))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "country_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`created["Code"]`,
+		`"{\"Code\":\"te\",\"Name\":\"test name\"}"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("the test has no %s:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "Id") {
+		t.Errorf("the test refers to Id:\n%s", data)
+	}
+}
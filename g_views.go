@@ -16,8 +16,16 @@ package main
 
 import (
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 // recipe
@@ -34,43 +42,579 @@ func generateView(viewpath, currpath string) {
 		os.Exit(2)
 	}
 
-	cfile := path.Join(absViewPath, "index.tpl")
-	if f, err := os.OpenFile(cfile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err == nil {
-		defer CloseFile(f)
-		f.WriteString(cfile)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", cfile, "\x1b[0m")
-	} else {
-		ColorLog("[ERRO] Could not create view file: %s\n", err)
-		os.Exit(2)
+	data := &ViewTemplateData{
+		ViewPath:  viewpath,
+		URL:       "/" + viewpath,
+		ModelName: strings.Title(path.Base(viewpath)),
+		Fields:    viewFields(viewpath, currpath),
 	}
+	if len(data.Fields) == 0 {
+		ColorLog("[WARN] No fields found for '%s', the views will have no columns or inputs\n", viewpath)
+	}
+	data.PkName = pkField(data.Fields)
 
-	cfile = path.Join(absViewPath, "show.tpl")
-	if f, err := os.OpenFile(cfile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err == nil {
-		defer CloseFile(f)
-		f.WriteString(cfile)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", cfile, "\x1b[0m")
+	// The pages get a controller and routes when there is a model to serve
+	idType := modelIDType(viewModelPath(viewpath, currpath), data.ModelName)
+	if idType != "" {
+		data.URL = registerPageRoutes(viewpath, currpath)
+		generatePageController(viewpath, currpath, idType, data)
 	} else {
-		ColorLog("[ERRO] Could not create view file: %s\n", err)
-		os.Exit(2)
+		ColorLog("[HINT] No model with a Get%sById function, so the controller rendering the views is left to you\n", data.ModelName)
 	}
 
-	cfile = path.Join(absViewPath, "create.tpl")
-	if f, err := os.OpenFile(cfile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err == nil {
-		defer CloseFile(f)
-		f.WriteString(cfile)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", cfile, "\x1b[0m")
-	} else {
-		ColorLog("[ERRO] Could not create view file: %s\n", err)
+	for _, v := range []struct{ name, tpl string }{
+		{"index.tpl", viewIndexTpl},
+		{"show.tpl", viewShowTpl},
+		{"create.tpl", viewCreateTpl},
+		{"edit.tpl", viewEditTpl},
+	} {
+		cfile := path.Join(absViewPath, v.name)
+		if f, err := os.OpenFile(cfile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err == nil {
+			defer CloseFile(f)
+			f.WriteString(templateOr("view/"+v.name, data, renderView(v.tpl, data)))
+			fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", cfile, "\x1b[0m")
+		} else {
+			ColorLog("[ERRO] Could not create view file: %s\n", err)
+			os.Exit(2)
+		}
+	}
+}
+
+// viewModelPath returns the file of the model of viewpath.
+func viewModelPath(viewpath, currpath string) string {
+	p, f := path.Split(viewpath)
+	return path.Join(currpath, "models", p, strings.ToLower(f)+".go")
+}
+
+// viewFields returns the fields shown by the views: those of -fields if it
+// is given, otherwise those of the model struct in models/<viewpath>.go.
+func viewFields(viewpath, currpath string) []TemplateField {
+	if fields != "" {
+		fds, err := parseFields(fields.String())
+		if err != nil {
+			ColorLog("[ERRO] Could not parse the fields: %s\n", err)
+			os.Exit(2)
+		}
+		return fds
+	}
+	mpath := viewModelPath(viewpath, currpath)
+	if !isExist(mpath) {
+		return nil
+	}
+	ColorLog("[INFO] Using fields of the model in '%s'\n", mpath)
+	fds, err := modelFields(mpath, strings.Title(path.Base(viewpath)))
+	if err != nil {
+		ColorLog("[WARN] Could not read the model: %s\n", err)
+	}
+	return fds
+}
+
+// modelIDType returns the type of the id taken by the Get<name>ById function
+// of the Go file fpath, int or int64, or an empty string if there is no such
+// function.
+func modelIDType(fpath, name string) string {
+	file, err := parser.ParseFile(token.NewFileSet(), fpath, nil, 0)
+	if err != nil {
+		return ""
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != "Get"+name+"ById" || len(fn.Type.Params.List) != 1 {
+			continue
+		}
+		if id, ok := fn.Type.Params.List[0].Type.(*ast.Ident); ok && (id.Name == "int" || id.Name == "int64") {
+			return id.Name
+		}
+	}
+	return ""
+}
+
+// registerPageRoutes maps the actions of the page controller of viewpath in
+// routers/router.go, under /<viewpath>, or under /pages/<viewpath> if another
+// controller, e.g. the one of bee generate controller, has that path already.
+// It returns the URL of the pages.
+func registerPageRoutes(viewpath, currpath string) string {
+	w := NewColorWriter(os.Stdout)
+
+	p, f := path.Split(viewpath)
+	ctrlType := strings.Title(f) + "PageController"
+	ctrlPkgPath := path.Join(getPackagePath(currpath), "controllers", p)
+	fpath := path.Join(currpath, "routers", "router.go")
+
+	url := "/" + viewpath
+	src, err := ioutil.ReadFile(fpath)
+	if err == nil && isPathRouted(src, url, ctrlType) {
+		url = "/pages" + url
+	}
+	hint := func() {
+		for _, m := range pageRoutes(url) {
+			ColorLog("[HINT] Add beego.Router(%q, &controllers.%s{}, %q) to routers/router.go\n", m.path, ctrlType, m.methods)
+		}
+	}
+	if err != nil {
+		ColorLog("[WARN] Could not read the routers file: %s\n", err)
+		hint()
+		return url
+	}
+	out, changed, err := addRoutes(src, url, ctrlPkgPath, ctrlType, pageRoutes(url))
+	if err != nil {
+		ColorLog("[WARN] Could not register the routes of '%s': %s\n", ctrlType, err)
+		hint()
+		return url
+	}
+	if !changed {
+		ColorLog("[INFO] '%s' is already registered in '%s'\n", ctrlType, fpath)
+		return url
+	}
+	if err := ioutil.WriteFile(fpath, out, 0644); err != nil {
+		ColorLog("[ERRO] Could not write the routers file: %s\n", err)
 		os.Exit(2)
 	}
+	fmt.Fprintf(w, "\t%s%supdate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+	return url
+}
+
+// pageRoutes returns the routes of the page controller serving url. The
+// forms post the PUT and DELETE requests with a _method field: beego looks
+// the route up with POST, then runs the action of the method in _method.
+func pageRoutes(url string) []routeMapping {
+	return []routeMapping{
+		{url, "get:Index;post:Create"},
+		{url + "/new", "get:New"},
+		{url + "/:id", "get:Show;post,put:Update;delete:Destroy"},
+		{url + "/:id/edit", "get:Edit"},
+	}
+}
 
-	cfile = path.Join(absViewPath, "edit.tpl")
-	if f, err := os.OpenFile(cfile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err == nil {
-		defer CloseFile(f)
-		f.WriteString(cfile)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", cfile, "\x1b[0m")
-	} else {
-		ColorLog("[ERRO] Could not create view file: %s\n", err)
+// generatePageController writes controllers/<viewpath>_page.go, the
+// controller rendering the views of viewpath. idType is the type of the id
+// of the model functions.
+func generatePageController(viewpath, currpath, idType string, data *ViewTemplateData) {
+	w := NewColorWriter(os.Stdout)
+
+	p, f := path.Split(viewpath)
+	packageName := "controllers"
+	modelPkgPath := path.Join(getPackagePath(currpath), "models", p)
+	if p != "" {
+		i := strings.LastIndex(p[:len(p)-1], "/")
+		packageName = p[i+1 : len(p)-1]
+	}
+
+	fp := path.Join(currpath, "controllers", p)
+	if err := os.MkdirAll(fp, 0777); err != nil {
+		ColorLog("[ERRO] Could not create controllers directory: %s\n", err)
 		os.Exit(2)
 	}
+	fpath := path.Join(fp, strings.ToLower(f)+"_page.go")
+	file, err := os.OpenFile(fpath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	if err != nil {
+		ColorLog("[ERRO] Could not create controller file: %s\n", err)
+		os.Exit(2)
+	}
+	defer CloseFile(file)
+
+	parseID := "strconv.ParseInt(c.Ctx.Input.Param(\":id\"), 10, 64)"
+	if idType == "int" {
+		parseID = "strconv.Atoi(c.Ctx.Input.Param(\":id\"))"
+	}
+	var resets []string
+	for _, fd := range data.Fields {
+		switch {
+		case fd.Name == data.PkName:
+		case fd.Kind == "string", fd.Kind == "text":
+			resets = append(resets, "\tv."+fd.Name+" = \"\"")
+		case fd.Kind == "bool":
+			resets = append(resets, "\tv."+fd.Name+" = false")
+		}
+	}
+	r := strings.NewReplacer(
+		"{{packageName}}", packageName,
+		"{{resetFields}}", strings.Join(resets, "\n"),
+		"{{modelPkgPath}}", modelPkgPath,
+		"{{modelName}}", data.ModelName,
+		"{{pkName}}", data.PkName,
+		"{{parseID}}", parseID,
+		"{{viewPath}}", data.ViewPath,
+		"{{url}}", data.URL,
+	)
+	file.WriteString(templateOr("view/controller.go", data, r.Replace(pageControllerTpl)))
+	formatSourceCode(fpath)
+	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+}
+
+var ormSizeRegexp = regexp.MustCompile(`size\((\d+)\)`)
+
+// pkField returns the name of the primary key among fds, Id if none of
+// them is marked auto or pk.
+func pkField(fds []TemplateField) string {
+	for _, fd := range fds {
+		if fd.Kind == "auto" || fd.Kind == "pk" {
+			return fd.Name
+		}
+	}
+	return "Id"
+}
+
+// modelFields reads the fields of the struct name in the Go file fpath.
+func modelFields(fpath, name string) ([]TemplateField, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), fpath, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	obj := file.Scope.Lookup(name)
+	if obj == nil {
+		return nil, fmt.Errorf("no type %s", name)
+	}
+	spec, ok := obj.Decl.(*ast.TypeSpec)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a type", name)
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a struct", name)
+	}
+
+	var fds []TemplateField
+	for _, field := range st.Fields.List {
+		var typ string
+		switch t := field.Type.(type) {
+		case *ast.Ident:
+			typ = t.Name
+		case *ast.SelectorExpr:
+			if x, ok := t.X.(*ast.Ident); ok {
+				typ = x.Name + "." + t.Sel.Name
+			}
+		}
+		if typ == "" {
+			// relations and other composite types are not edited in forms
+			continue
+		}
+		var tag string
+		if field.Tag != nil {
+			tag, _ = strconv.Unquote(field.Tag.Value)
+		}
+		orm := reflect.StructTag(tag).Get("orm")
+		if orm == "-" {
+			continue
+		}
+		for _, n := range field.Names {
+			fd := TemplateField{Name: n.Name, Column: snakeString(n.Name), Type: typ, Valid: reflect.StructTag(tag).Get("valid"), Tag: tag}
+			switch {
+			case typ == "time.Time":
+				fd.Kind = "datetime"
+			case typ == "string" && strings.Contains(orm, "type(longtext)"), typ == "string" && strings.Contains(orm, "type(text)"):
+				fd.Kind = "text"
+			case strings.Contains(orm, "auto") || (n.Name == "Id" && !strings.Contains(orm, "pk")):
+				fd.Kind = "auto"
+			case strings.Contains(orm, "pk"):
+				fd.Kind = "pk"
+			default:
+				fd.Kind = typ
+			}
+			if m := ormSizeRegexp.FindStringSubmatch(orm); m != nil {
+				fd.Size = m[1]
+			}
+			fds = append(fds, fd)
+		}
+	}
+	return fds, nil
+}
+
+// renderView fills in the placeholders of a built-in view template.
+func renderView(tpl string, data *ViewTemplateData) string {
+	var head, row, details, createInputs, editInputs []string
+	for _, fd := range data.Fields {
+		head = append(head, "\t\t\t<th>"+fd.Name+"</th>")
+		row = append(row, "\t\t\t<td>"+viewValue(fd, ".")+"</td>")
+		details = append(details, "\t<dt>"+fd.Name+"</dt>\n\t<dd>"+viewValue(fd, ".item.")+"</dd>")
+		if fd.Kind == "auto" || fd.Name == data.PkName {
+			continue
+		}
+		createInputs = append(createInputs, viewInput(fd, ""))
+		editInputs = append(editInputs, viewInput(fd, ".item."))
+	}
+	r := strings.NewReplacer(
+		"{{url}}", data.URL,
+		"{{pkName}}", data.PkName,
+		"{{modelName}}", data.ModelName,
+		"{{tableHead}}", strings.Join(head, "\n"),
+		"{{tableRow}}", strings.Join(row, "\n"),
+		"{{details}}", strings.Join(details, "\n"),
+		"{{createInputs}}", strings.Join(createInputs, "\n"),
+		"{{editInputs}}", strings.Join(editInputs, "\n"),
+	)
+	return r.Replace(tpl)
+}
+
+// viewValue returns the template action printing fd of the value at prefix.
+func viewValue(fd TemplateField, prefix string) string {
+	if fd.Kind == "datetime" {
+		return `{{dateformat ` + prefix + fd.Name + ` "2006-01-02 15:04:05"}}`
+	}
+	return "{{" + prefix + fd.Name + "}}"
+}
+
+// viewInput returns the form input of fd. prefix is empty for a new
+// record, otherwise the value at prefix fills the input in.
+func viewInput(fd TemplateField, prefix string) string {
+	value := func(s string) string {
+		if prefix == "" {
+			return ""
+		}
+		return s
+	}
+	label := "\t<label for=\"" + fd.Column + "\">" + fd.Name + "</label>\n\t"
+	attrs := `id="` + fd.Column + `" name="` + fd.Name + `"`
+	// ParseForm cannot read an empty number, so numbers are always required
+	numeric := strings.HasPrefix(fd.Kind, "int") || strings.HasPrefix(fd.Kind, "uint") ||
+		strings.HasPrefix(fd.Kind, "float") || fd.Kind == "pk"
+	if numeric || (strings.Contains(fd.Valid, "Required") && fd.Kind != "bool") {
+		attrs += ` required`
+	}
+	switch fd.Kind {
+	case "text":
+		return label + `<textarea ` + attrs + `>` + value("{{"+prefix+fd.Name+"}}") + `</textarea>`
+	case "bool":
+		return label + `<input type="checkbox" ` + attrs + ` value="true"` + value(`{{if `+prefix+fd.Name+`}} checked{{end}}`) + `>`
+	case "datetime":
+		// with step="1" the browser sends seconds, which beego's ParseForm needs
+		return label + `<input type="datetime-local" step="1" ` + attrs + value(` value="{{dateformat `+prefix+fd.Name+` "2006-01-02T15:04:05"}}"`) + `>`
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "pk":
+		return label + `<input type="number" step="1" ` + attrs + value(` value="{{`+prefix+fd.Name+`}}"`) + `>`
+	case "float", "float32", "float64":
+		return label + `<input type="number" step="any" ` + attrs + value(` value="{{`+prefix+fd.Name+`}}"`) + `>`
+	}
+	maxlength := ""
+	if fd.Size != "" {
+		maxlength = ` maxlength="` + fd.Size + `"`
+	}
+	return label + `<input type="text" ` + attrs + maxlength + value(` value="{{`+prefix+fd.Name+`}}"`) + `>`
+}
+
+var viewIndexTpl = `{{/*
+	List of {{modelName}}, rendered by Index. The controller sets:
+	  .list       the {{modelName}} records of the current page
+	  .paginator  pagination.SetPaginator(c.Ctx, perPage, total)
+	  .xsrfdata   template.HTML(c.XSRFFormHTML())
+*/}}
+<h1>{{modelName}}</h1>
+
+<p><a href="{{url}}/new">New {{modelName}}</a></p>
+
+<table>
+	<thead>
+		<tr>
+{{tableHead}}
+			<th></th>
+		</tr>
+	</thead>
+	<tbody>
+	{{range .list}}
+		<tr>
+{{tableRow}}
+			<td>
+				<a href="{{url}}/{{.{{pkName}}}}">Show</a>
+				<a href="{{url}}/{{.{{pkName}}}}/edit">Edit</a>
+				<form action="{{url}}/{{.{{pkName}}}}" method="post" style="display:inline">
+					{{$.xsrfdata}}
+					<input type="hidden" name="_method" value="DELETE">
+					<button type="submit">Delete</button>
+				</form>
+			</td>
+		</tr>
+	{{else}}
+		<tr><td>No {{modelName}} yet.</td></tr>
+	{{end}}
+	</tbody>
+</table>
+
+{{if .paginator.HasPages}}
+<ul class="pagination">
+	{{if .paginator.HasPrev}}
+	<li><a href="{{.paginator.PageLinkFirst}}">&laquo;</a></li>
+	<li><a href="{{.paginator.PageLinkPrev}}">&lsaquo;</a></li>
+	{{end}}
+	{{range $page := .paginator.Pages}}
+	<li{{if $.paginator.IsActive $page}} class="active"{{end}}><a href="{{$.paginator.PageLink $page}}">{{$page}}</a></li>
+	{{end}}
+	{{if .paginator.HasNext}}
+	<li><a href="{{.paginator.PageLinkNext}}">&rsaquo;</a></li>
+	<li><a href="{{.paginator.PageLinkLast}}">&raquo;</a></li>
+	{{end}}
+</ul>
+{{end}}
+`
+
+var viewShowTpl = `{{/*
+	Details of a {{modelName}}, rendered by Show. The controller sets:
+	  .item  the {{modelName}}
+*/}}
+<h1>{{modelName}}</h1>
+
+<dl>
+{{details}}
+</dl>
+
+<p>
+	<a href="{{url}}/{{.item.{{pkName}}}}/edit">Edit</a>
+	<a href="{{url}}">Back</a>
+</p>
+`
+
+var viewCreateTpl = `{{/*
+	Form creating a {{modelName}}, rendered by New and posted to {{url}}. The
+	controller sets:
+	  .error     the error of the previous post, if any
+	  .xsrfdata  template.HTML(c.XSRFFormHTML())
+*/}}
+<h1>New {{modelName}}</h1>
+
+{{if .error}}<p class="error">{{.error}}</p>{{end}}
+
+<form action="{{url}}" method="post">
+	{{.xsrfdata}}
+{{createInputs}}
+	<button type="submit">Create</button>
+</form>
+
+<p><a href="{{url}}">Back</a></p>
+`
+
+var viewEditTpl = `{{/*
+	Form updating a {{modelName}}, rendered by Edit and posted to {{url}}/:id
+	as a PUT. The controller sets:
+	  .item      the {{modelName}}
+	  .error     the error of the previous post, if any
+	  .xsrfdata  template.HTML(c.XSRFFormHTML())
+*/}}
+<h1>Edit {{modelName}}</h1>
+
+{{if .error}}<p class="error">{{.error}}</p>{{end}}
+
+<form action="{{url}}/{{.item.{{pkName}}}}" method="post">
+	{{.xsrfdata}}
+	<input type="hidden" name="_method" value="PUT">
+{{editInputs}}
+	<button type="submit">Update</button>
+</form>
+
+<p>
+	<a href="{{url}}/{{.item.{{pkName}}}}">Show</a>
+	<a href="{{url}}">Back</a>
+</p>
+`
+
+var pageControllerTpl = `package {{packageName}}
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+
+	models "{{modelPkgPath}}"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/utils/pagination"
+)
+
+// {{modelName}}PageController serves the {{modelName}} pages of the views in
+// views/{{viewPath}}.
+type {{modelName}}PageController struct {
+	beego.Controller
+}
+
+// Index lists the {{modelName}} records, a page at a time.
+func (c *{{modelName}}PageController) Index() {
+	q, err := models.ParseQuery(c.Input())
+	if err != nil {
+		c.Abort("400")
+	}
+	// the links of the paginator give the page in p
+	if p, err := c.GetInt64("p"); err == nil && p > 0 {
+		q.Page = p
+	}
+	l, total, err := models.GetAll{{modelName}}(q)
+	if err != nil {
+		c.Abort("500")
+	}
+	c.Data["list"] = l
+	c.Data["paginator"] = pagination.SetPaginator(c.Ctx, int(q.Limit()), total)
+	c.Data["xsrfdata"] = template.HTML(c.XSRFFormHTML())
+	c.TplName = "{{viewPath}}/index.tpl"
+}
+
+// Show shows a {{modelName}}.
+func (c *{{modelName}}PageController) Show() {
+	c.Data["item"] = c.item()
+	c.TplName = "{{viewPath}}/show.tpl"
+}
+
+// New shows the form creating a {{modelName}}.
+func (c *{{modelName}}PageController) New() {
+	c.Data["xsrfdata"] = template.HTML(c.XSRFFormHTML())
+	c.TplName = "{{viewPath}}/create.tpl"
+}
+
+// Create creates a {{modelName}} from the form of New.
+func (c *{{modelName}}PageController) Create() {
+	var v models.{{modelName}}
+	err := c.ParseForm(&v)
+	if err == nil {
+		_, err = models.Add{{modelName}}(&v)
+	}
+	if err != nil {
+		c.Data["error"] = err.Error()
+		c.New()
+		return
+	}
+	c.Redirect(fmt.Sprintf("{{url}}/%v", v.{{pkName}}), 302)
+}
+
+// Edit shows the form updating a {{modelName}}.
+func (c *{{modelName}}PageController) Edit() {
+	c.Data["item"] = c.item()
+	c.Data["xsrfdata"] = template.HTML(c.XSRFFormHTML())
+	c.TplName = "{{viewPath}}/edit.tpl"
+}
+
+// Update updates a {{modelName}} from the form of Edit.
+func (c *{{modelName}}PageController) Update() {
+	v := c.item()
+	// ParseForm leaves the fields of empty inputs and unchecked boxes alone
+{{resetFields}}
+	err := c.ParseForm(v)
+	if err == nil {
+		err = models.Update{{modelName}}ById(v)
+	}
+	if err != nil {
+		c.Data["item"] = v
+		c.Data["error"] = err.Error()
+		c.Data["xsrfdata"] = template.HTML(c.XSRFFormHTML())
+		c.TplName = "{{viewPath}}/edit.tpl"
+		return
+	}
+	c.Redirect(fmt.Sprintf("{{url}}/%v", v.{{pkName}}), 302)
+}
+
+// Destroy deletes a {{modelName}}.
+func (c *{{modelName}}PageController) Destroy() {
+	v := c.item()
+	if err := models.Delete{{modelName}}(v.{{pkName}}); err != nil {
+		c.Abort("500")
+	}
+	c.Redirect("{{url}}", 302)
+}
+
+// item returns the {{modelName}} of the :id of the URL, or aborts with a 404.
+func (c *{{modelName}}PageController) item() *models.{{modelName}} {
+	id, err := {{parseID}}
+	if err != nil {
+		c.Abort("404")
+	}
+	v, err := models.Get{{modelName}}ById(id)
+	if err != nil {
+		c.Abort("404")
+	}
+	return v
 }
+`
@@ -285,6 +285,7 @@ func createhprose(cmd *Command, args []string) int {
 	}
 
 	ColorLog("[INFO] Creating Hprose application...\n")
+	data := &AppTemplateData{Appname: args[0], PkgPath: packpath}
 	// func MkdirAll(path string, perm FileMode) error
 	// MkdirAll使用指定的权限和名称创建一个目录，包括任何必要的上级目录，并返回nil，否则返回错误。
 	// 权限位perm会应用在每一个被本函数创建的目录上。
@@ -307,7 +308,7 @@ func createhprose(cmd *Command, args []string) int {
 	// func Replace(s, old, new string, n int) string
 	// 返回将s中前n个不重叠old子串都替换为new的新字符串，如果n<0会替换所有old子串。
 	WriteToFile(path.Join(apppath, "conf", "app.conf"),
-		strings.Replace(hproseconf, "{{.Appname}}", args[0], -1))
+		templateOr("hprose/conf/app.conf", data, strings.Replace(hproseconf, "{{.Appname}}", args[0], -1)))
 
 	if conn != "" {
 		ColorLog("[INFO] Using '%s' as 'driver'\n", driver)
@@ -318,32 +319,36 @@ func createhprose(cmd *Command, args []string) int {
 		maingoContent := strings.Replace(hproseMainconngo, "{{.Appname}}", packpath, -1)
 		maingoContent = strings.Replace(maingoContent, "{{.DriverName}}", string(driver), -1)
 		maingoContent = strings.Replace(maingoContent, "{{HproseFunctionList}}", strings.Join(hproseAddFunctions, ""), -1)
+		data.Driver = string(driver)
+		data.Conn = conn.String()
+		data.HproseFunctions = strings.Join(hproseAddFunctions, "")
 		if driver == "mysql" {
-			maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", `_ "github.com/go-sql-driver/mysql"`, -1)
+			data.DriverPkg = `_ "github.com/go-sql-driver/mysql"`
 		} else if driver == "postgres" {
-			maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", `_ "github.com/lib/pq"`, -1)
+			data.DriverPkg = `_ "github.com/lib/pq"`
 		}
+		maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", data.DriverPkg, -1)
 		WriteToFile(path.Join(apppath, "main.go"),
-			strings.Replace(
+			templateOr("hprose/main.go", data, strings.Replace(
 				maingoContent,
 				"{{.conn}}",
 				conn.String(),
 				-1,
-			),
+			)),
 		)
 	} else {
 		os.Mkdir(path.Join(apppath, "models"), 0755)
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "models"), "\x1b[0m")
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "models", "object.go"), "\x1b[0m")
-		WriteToFile(path.Join(apppath, "models", "object.go"), apiModels)
+		WriteToFile(path.Join(apppath, "models", "object.go"), templateOr("hprose/models/object.go", data, apiModels))
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "models", "user.go"), "\x1b[0m")
-		WriteToFile(path.Join(apppath, "models", "user.go"), apiModels2)
+		WriteToFile(path.Join(apppath, "models", "user.go"), templateOr("hprose/models/user.go", data, apiModels2))
 
 		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "main.go"), "\x1b[0m")
 		WriteToFile(path.Join(apppath, "main.go"),
-			strings.Replace(hproseMaingo, "{{.Appname}}", packpath, -1))
+			templateOr("hprose/main.go", data, strings.Replace(hproseMaingo, "{{.Appname}}", packpath, -1)))
 	}
 	ColorLog("[SUCC] New Hprose application successfully created!\n")
 	return 0
@@ -17,7 +17,11 @@ package main
 import (
 	"archive/tar" // tar包实现了tar格式压缩文件的存取
 	"archive/zip" // zip包提供了zip档案文件的读写服务。不支持跨硬盘的压缩。
+	"bytes"
+	"compress/flate"
 	"compress/gzip" // gzip包实现了gzip格式压缩文件的读写
+	"crypto/sha256"
+	"encoding/hex"
 	"flag" // 命令行参数的解析
 	"fmt"	// 格式化i/o
 	"io"	// I/O原语的基本接口
@@ -30,9 +34,14 @@ import (
 	"sort" // 排序切片和用户自定义数据集的函数
 	"strconv" // 基本数据类型和其字符串表示的相互转换
 	"strings" // 操作字符的简单函数
+	"sync"
 	"syscall"	//封装系统调用,包含底层操作系统原语。
 			//细节取决于底层系统，默认情况下，godoc将显示当前系统的系统调用的文件。
+	"text/tabwriter"
 	"time"	// 时间的显示和测量用的函数。日历的计算采用的是公历。
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 ) 
 
 var cmdPack = &Command{
@@ -47,19 +56,52 @@ This eases the deployment by extracting the zip file to a server.
 -b            build specify platform app (default: true).
 -ba           additional args of go build
 -be=[]        additional ENV Variables of go build. eg: GOARCH=arm
+-targets=""   GOOS/GOARCH list, eg: linux/amd64,linux/arm64,windows/amd64
+              each target is built in parallel and packed into its own
+              archive, named <app>_<goos>_<goarch>.<format>
 -o            compressed file output dir. default use current path
--f=""         format: tar.gz, zip (default: tar.gz)
+-f=""         format: tar.gz, tar.xz, tar.zst, tar, zip or dir (default: tar.gz)
+              dir copies the files to the directory <app>_dir
+-f=deb|rpm    linux package: the binary and the app files go to /opt/<app>,
+              conf to /etc/<app>, plus a systemd service <app>.service
+              metadata is read from "package" in bee.json: name, version,
+              release, maintainer, description, homepage, license, depends
+              and user, the user running the service
+-l=-1         compression level: 0-9 for tar.gz, zip and tar.xz, 1-22 for
+              tar.zst (default: the default level of the format)
+              zip entries are only compressed when -l is given
 -exp=""       relpath exclude prefix (default: .). use : as separator
 -exs=""       relpath exclude suffix (default: .go:.DS_Store:.tmp). use : as separator
               all path use : as separator
 -exr=[]       file/directory name exclude by Regexp (default: ^).
+              the .beepackignore files of the app exclude files too, with the
+              syntax of .gitignore: globs, **, !negation and dir/ patterns
+-r=false      reproducible: the same sources give the same archive, byte for byte.
+              entries are sorted, owned by root, timestamped with SOURCE_DATE_EPOCH
+              (default: the time of the last git commit) and have 0644 or 0755
+              permissions, the app is built with -trimpath, and the SHA-256 of
+              the archive is written to <archive>.sha256
+-gitignore    exclude the files of the .gitignore files too (default: false).
+-list         print the files packed, without building nor packing (default: false).
 -fs=false     follow symlink (default: false).
 -ss=false     skip symlink (default: false)
               default embed symlink into compressed file
 -v=false      verbose
+
+The binary gets its version, from the last git tag, its commit, build time
+and Go version in the Version, Commit, BuildTime and GoVersion variables of
+package main, or of "package" of "build_info" in bee.json, with -ldflags -X.
+They are written to VERSION and build.json next to it too. Set "disable" of
+"build_info" to true to leave them out.
 `,
 }
 
+// Default excludes of bee pack, also used by bee dockerize.
+const (
+	packExcludePrefix = "."
+	packExcludeSuffix = ".go:.DS_Store:.tmp"
+)
+
 var (
 	appPath   string
 	excludeP  string
@@ -73,6 +115,16 @@ var (
 	buildEnvs ListOpts
 	verbose   bool
 	format    string
+	// archives written by this run, never packed into one another
+	packedArchives = make(map[string]bool)
+	packTargets    string
+	reproducible   bool
+	packLevel      int
+	packList       bool
+	gitignore      bool
+	packIgnore     *ignoreRules // .beepackignore files of the app
+	packBuildInfo  *buildInfo   // set in the binary and written to VERSION and build.json
+	packModTime    time.Time // timestamp of the entries in reproducible mode
 	w         io.Writer
 )
 
@@ -113,10 +165,15 @@ func init() {
 	// 例如，用户可以创建一个flag，可以用Value接口的Set方法将逗号分隔的字符串转化为字符串切片。
 	fs.Var(&buildEnvs, "be", "additional ENV Variables of go build. eg: GOARCH=arm")
 	fs.StringVar(&outputP, "o", "", "compressed file output dir. default use current path")
-	fs.StringVar(&format, "f", "tar.gz", "format. [ tar.gz / zip ]")
-	fs.StringVar(&excludeP, "exp", ".", "path exclude prefix. use : as separator")
-	fs.StringVar(&excludeS, "exs", ".go:.DS_Store:.tmp", "path exclude suffix. use : as separator")
+	fs.StringVar(&format, "f", "tar.gz", "format. [ tar.gz / tar.xz / tar.zst / tar / zip / dir / deb / rpm ]")
+	fs.StringVar(&packTargets, "targets", "", "GOOS/GOARCH list built in parallel, one archive each. eg: linux/amd64,windows/amd64")
+	fs.StringVar(&excludeP, "exp", packExcludePrefix, "path exclude prefix. use : as separator")
+	fs.StringVar(&excludeS, "exs", packExcludeSuffix, "path exclude suffix. use : as separator")
 	fs.Var(&excludeR, "exr", "filename exclude by Regexp")
+	fs.IntVar(&packLevel, "l", -1, "compression level. default is the default level of the format")
+	fs.BoolVar(&reproducible, "r", false, "reproducible archive, with a SHA-256 checksum file")
+	fs.BoolVar(&packList, "list", false, "print the files packed, without building nor packing")
+	fs.BoolVar(&gitignore, "gitignore", false, "exclude the files of .gitignore too")
 	fs.BoolVar(&fsym, "fs", false, "follow symlink")
 	fs.BoolVar(&ssym, "ss", false, "skip symlink")
 	fs.BoolVar(&verbose, "v", false, "verbose")
@@ -234,6 +291,9 @@ func (wft *walkFileTree) isEmpty(fpath string) bool {
 		if wft.isExcludeName(fn) {
 			continue
 		}
+		if wft.isIgnored(fp, fi.IsDir()) {
+			continue
+		}
 		// ModeSymlink
 		// L: 符号链接（不是快捷方式文件）
 		if fi.Mode()&os.ModeSymlink > 0 {
@@ -296,7 +356,10 @@ func (wft *walkFileTree) walkLeaf(fpath string, fi os.FileInfo, err error) error
 		return err
 	}
 
-	if fpath == outputP {
+	if fpath == outputP || packedArchives[fpath] {
+		if fi.IsDir() {
+			return path.SkipDir
+		}
 		return nil
 	}
 
@@ -347,6 +410,10 @@ func (wft *walkFileTree) iterDirectory(fpath string, fi os.FileInfo) error {
 		if wft.isExclude(relPath) {
 			return nil
 		}
+
+		if wft.isIgnored(fpath, fi.IsDir()) {
+			return nil
+		}
 	}
 
 	err := wft.walkLeaf(fpath, fi, nil)
@@ -415,6 +482,9 @@ func (wft *tarWalk) compress(name, fpath string, fi os.FileInfo) (bool, error) {
 	// type Header struct {
     	// Name       string    // 记录头域的文件名
 	hdr.Name = name
+	if reproducible {
+		normalizeTarHeader(hdr)
+	}
 	
 	// wft.tw 为 *tar.Writer
 	// Writer类型提供了POSIX.1格式的tar档案文件的顺序写入。
@@ -473,6 +543,12 @@ func (wft *zipWalk) compress(name, fpath string, fi os.FileInfo) (bool, error) {
 	//Name string
 	// Name是文件名，它必须是相对路径，不能以设备或斜杠开始，只接受'/'作为路径分隔符
 	hdr.Name = name
+	if packLevel != -1 {
+		hdr.Method = zip.Deflate
+	}
+	if reproducible {
+		normalizeZipHeader(hdr)
+	}
 	
 	//*zip.Writer
 	// Writer类型实现了zip文件的写入器。
@@ -518,14 +594,137 @@ func (wft *zipWalk) compress(name, fpath string, fi os.FileInfo) (bool, error) {
 	return true, nil
 }
 
+// dirWalk copies the files to the directory dir instead of an archive.
+type dirWalk struct {
+	walkFileTree
+	dir string
+}
+
+func (wft *dirWalk) compress(name, fpath string, fi os.FileInfo) (bool, error) {
+	dst := path.Join(wft.dir, path.FromSlash(name))
+	if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+
+	if fi.Mode()&os.ModeSymlink > 0 {
+		link, err := os.Readlink(fpath)
+		if err != nil {
+			return false, err
+		}
+		return true, os.Symlink(link, dst)
+	}
+
+	mode := fi.Mode()
+	if reproducible {
+		mode = normalizedMode(mode)
+	}
+
+	fr, err := os.Open(fpath)
+	if err != nil {
+		return false, err
+	}
+	defer CloseFile(fr)
+	fw, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return false, err
+	}
+	if _, err = io.Copy(fw, fr); err != nil {
+		fw.Close()
+		return false, err
+	}
+	if err = fw.Close(); err != nil {
+		return false, err
+	}
+	if reproducible {
+		return true, os.Chtimes(dst, packModTime, packModTime)
+	}
+	return true, os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// xzDictCaps are the dictionary sizes of the xz presets 0 to 9.
+var xzDictCaps = []int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// packSuffixes are the suffixes of the outputs of the formats of bee pack.
+var packSuffixes = []string{".tar.gz", ".tar.xz", ".tar.zst", ".tar", ".zip", "_dir", ".deb", ".rpm"}
+
+// checkPackLevel returns an error if the compression level is out of the
+// range of format, -1 being the default level.
+func checkPackLevel(format string, level int) error {
+	max := 9
+	switch format {
+	case "tar", "dir", "deb", "rpm":
+		return nil
+	case "tar.zst":
+		if level == 0 {
+			return fmt.Errorf("invalid zstd level 0, use 1 to 22")
+		}
+		max = 22
+	}
+	if level < -1 || level > max {
+		return fmt.Errorf("invalid compression level %d for %s, use 0 to %d", level, format, max)
+	}
+	return nil
+}
+
+// newCompressor returns the writer compressing the tar stream of format
+// to w, at level, -1 being the default level of the format. The level is
+// checked by checkPackLevel.
+func newCompressor(format string, w io.Writer, level int) (io.WriteCloser, error) {
+	switch format {
+	case "tar":
+		return nopWriteCloser{w}, nil
+	case "tar.xz":
+		if level == -1 {
+			return xz.NewWriter(w)
+		}
+		return xz.WriterConfig{DictCap: xzDictCaps[level]}.NewWriter(w)
+	case "tar.zst":
+		if level == -1 {
+			return zstd.NewWriter(w)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	// func NewWriterLevel(w io.Writer, level int) (*Writer, error)
+	// NewWriterLevel类似NewWriter但指定了压缩水平而不是采用默认的DefaultCompression。
+	// 参数level可以是DefaultCompression、NoCompression或BestSpeed到BestCompression之间包括二者的任何整数。
+	return gzip.NewWriterLevel(w, level)
+}
+
+// listWalk prints the files bee pack includes instead of packing them.
+type listWalk struct {
+	walkFileTree
+}
+
+func (wft *listWalk) compress(name, fpath string, fi os.FileInfo) (bool, error) {
+	fmt.Println(name)
+	return true, nil
+}
+
 func packDirectory(excludePrefix []string, excludeSuffix []string,
 	excludeRegexp []*regexp.Regexp, includePath ...string) (err error) {
-	// ./util.go
-	ColorLog("Excluding relpath prefix: %s\n", strings.Join(excludePrefix, ":"))
-	ColorLog("Excluding relpath suffix: %s\n", strings.Join(excludeSuffix, ":"))
-	if len(excludeRegexp) > 0 {
-		ColorLog("Excluding filename regex: `%s`\n", strings.Join(excludeR, "`, `"))
+	if format == "dir" {
+		if fi, err := os.Stat(outputP); err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("%s already exists and is not a directory", outputP)
+			}
+			os.RemoveAll(outputP)
+		}
+		walk := new(dirWalk)
+		walk.allfiles = make(map[string]bool)
+		walk.dir = outputP
+		walk.wak = walk
+		walk.excludePrefix = excludePrefix
+		walk.excludeSuffix = excludeSuffix
+		walk.excludeRegexp = excludeRegexp
+		return walkRoots(walk, includePath)
 	}
+
 	// func OpenFile(name string, flag int, perm FileMode) (file *File, err error)
 	// OpenFile是一个更一般性的文件打开函数，大多数调用者都应用Open或Create代替本函数。
 	// 它会使用指定的选项（如O_RDONLY等）、指定的模式（如0666等）打开指定名称的文件。如果操作成功，返回的文件对象可用于I/O。
@@ -542,6 +741,7 @@ func packDirectory(excludePrefix []string, excludeSuffix []string,
 	if err != nil {
 		return err
 	}
+	defer CloseFile(w)
 
 	var wft walker
 
@@ -555,6 +755,12 @@ func packDirectory(excludePrefix []string, excludeSuffix []string,
 			// Close方法通过写入中央目录关闭该*Writer。本方法不会也没办法关闭下层的io.Writer接口。
 			zw.Close()
 		}()
+		if packLevel != -1 {
+			level := packLevel
+			zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(out, level)
+			})
+		}
 		walk.allfiles = make(map[string]bool)
 		walk.zw = zw
 		walk.wak = walk
@@ -564,22 +770,18 @@ func packDirectory(excludePrefix []string, excludeSuffix []string,
 		wft = walk
 	} else {
 		walk := new(tarWalk)
-		// func NewWriter(w io.Writer) *Writer
-		// NewWriter创建并返回一个Writer。
-		// 写入返回值的数据都会在压缩后写入w。
-		// 调用者有责任在结束写入后调用返回值的Close方法。
-		// 因为写入的数据可能保存在缓冲中没有刷新入下层。
-		// 如要设定Writer.Header字段，调用者必须在第一次调用Write方法或者Close方法之前设置。
-		// Header字段的Comment和Name字段是go的utf-8字符串，但下层格式要求为NUL中止的ISO 8859-1 (Latin-1)序列。
-		// 如果这两个字段的字符串包含NUL或非Latin-1字符，将导致Write方法返回错误。
-		cw := gzip.NewWriter(w)
+		// tar, tar.gz, tar.xz and tar.zst only differ by the compressor
+		// the tar.Writer writes to.
+		cw, err := newCompressor(format, w, packLevel)
+		if err != nil {
+			return err
+		}
 		// func NewWriter(w io.Writer) *Writer
 		// NewWriter创建一个写入w的*Writer。
 		tw := tar.NewWriter(cw)
 
 		defer func() {
 			tw.Flush()
-			cw.Flush()
 			tw.Close()
 			cw.Close()
 		}()
@@ -592,14 +794,16 @@ func packDirectory(excludePrefix []string, excludeSuffix []string,
 		wft = walk
 	}
 
-	for _, p := range includePath {
-		err = wft.walkRoot(p)
-		if err != nil {
-			return
+	return walkRoots(wft, includePath)
+}
+
+func walkRoots(wft walker, roots []string) error {
+	for _, p := range roots {
+		if err := wft.walkRoot(p); err != nil {
+			return err
 		}
 	}
-
-	return
+	return nil
 }
 
 func isBeegoProject(thePath string) bool {
@@ -676,6 +880,10 @@ func packApp(cmd *Command, args []string) int {
 	}
 
 	ColorLog("Packaging application: %s\n", thePath)
+	// ./packignore.go
+	packIgnore = newIgnoreRules(thePath, ignoreFiles(gitignore)...)
+	// ./pack_pkg.go
+	loadPackConf(thePath)
 	
 	// func Base(path string) string
 	// Base函数返回路径的最后一个元素。
@@ -711,103 +919,126 @@ func packApp(cmd *Command, args []string) int {
 	// 如果path指定了一个已经存在的目录，MkdirAll不做任何操作并返回nil。
 	os.Mkdir(tmpdir, 0700)
 
-	if build {
-		ColorLog("Building application...\n")
-		var envs []string
-		for _, env := range buildEnvs {
-			// func SplitN(s, sep string, n int) []string
-			// 用去掉s中出现的sep的方式进行分割，会分割到结尾，并返回生成的所有片段组成的切片（每一个sep都会进行一次切割，即使两个sep相邻，也会进行两次切割）。
-			// 如果sep为空字符，Split会将s切分成每一个unicode码值一个字符串。
-			// 参数n决定返回的切片的数目：
-			// n > 0 : 返回的切片最多n个子字符串；最后一个子字符串包含未进行切割的部分。
-			// n == 0: 返回nil
-			// n < 0 : 返回所有的子字符串组成的切片
-			parts := strings.SplitN(env, "=", 2)
-			if len(parts) == 2 {
-				// func TrimSpace(s string) string
-				// 返回将s前后端所有空白（unicode.IsSpace指定）都去掉的字符串。
-				k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
-				if len(k) > 0 && len(v) > 0 {
-					switch k {
-					case "GOOS":
-						goos = v
-					case "GOARCH":
-						goarch = v
-					default:
-						envs = append(envs, fmt.Sprintf("%s=%s", k, v))
-					}
+	var envs []string
+	for _, env := range buildEnvs {
+		// func SplitN(s, sep string, n int) []string
+		// 用去掉s中出现的sep的方式进行分割，会分割到结尾，并返回生成的所有片段组成的切片（每一个sep都会进行一次切割，即使两个sep相邻，也会进行两次切割）。
+		// 如果sep为空字符，Split会将s切分成每一个unicode码值一个字符串。
+		// 参数n决定返回的切片的数目：
+		// n > 0 : 返回的切片最多n个子字符串；最后一个子字符串包含未进行切割的部分。
+		// n == 0: 返回nil
+		// n < 0 : 返回所有的子字符串组成的切片
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) == 2 {
+			// func TrimSpace(s string) string
+			// 返回将s前后端所有空白（unicode.IsSpace指定）都去掉的字符串。
+			k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			if len(k) > 0 && len(v) > 0 {
+				switch k {
+				case "GOOS":
+					goos = v
+				case "GOARCH":
+					goarch = v
+				default:
+					envs = append(envs, fmt.Sprintf("%s=%s", k, v))
 				}
 			}
 		}
-		// func Setenv(key, value string) error
-		// Setenv设置名为key的环境变量。如果出错会返回该错误。
-		os.Setenv("GOOS", goos)
-		os.Setenv("GOARCH", goarch)
-
-		ColorLog("Env: GOOS=%s GOARCH=%s\n", goos, goarch)
+	}
 
-		binPath := path.Join(tmpdir, appName)
-		if goos == "windows" {
-			binPath += ".exe"
+	if reproducible {
+		packModTime, err = sourceDateEpoch(thePath)
+		if err != nil {
+			exitPrint(err.Error())
 		}
+		ColorLog("Reproducible: timestamps set to %s\n", packModTime.Format(time.RFC3339))
+	}
 
-		args := []string{"build", "-o", binPath}
-		if len(buildArgs) > 0 {
-			// func Fields(s string) []string
-			// 返回将字符串按照空白（unicode.IsSpace确定，可以是一到多个连续的空白字符）分割的多个字符串。
-			// 如果字符串全部是空白或者是空字符串的话，会返回空切片。
-			args = append(args, strings.Fields(buildArgs)...)
+	if build && !conf.BuildInfo.Disable {
+		buildTime := time.Now()
+		if reproducible {
+			buildTime = packModTime
 		}
+		// ./buildinfo.go
+		packBuildInfo = readBuildInfo(thePath, buildTime)
+		ColorLog("Version: %s, commit %s\n", packBuildInfo.Version, packBuildInfo.Commit)
+	}
 
-		if verbose {
-			// func Fprintf(w io.Writer, format string, a ...interface{}) (n int, err error)
-			// Fprintf根据format参数生成格式化的字符串并写入w。返回写入的字节数和遇到的任何错误。
-			fmt.Fprintf(w, "\t%s%s+ go %s%s%s\n", "\x1b[32m", "\x1b[1m", strings.Join(args, " "), "\x1b[21m", "\x1b[0m")
+	targets := []*packTarget{{goos: goos, goarch: goarch, tmpdir: tmpdir}}
+	if packTargets != "" {
+		if !build {
+			exitPrint("-targets needs -b=true")
 		}
-		
-		// func Command(name string, arg ...string) *Cmd
-		// 函数返回一个*Cmd，用于使用给出的参数执行name指定的程序。
-		// 返回值只设定了Path和Args两个参数。
-		// 如果name不含路径分隔符，将使用LookPath获取完整路径；否则直接使用name。
-		// 参数arg不应包含命令名。
-		execmd := exec.Command("go", args...)
-		// type Cmd struct {
-		// Env []string
-		// Env指定进程的环境，如为nil，则是在当前进程的环境下执行。
-		execmd.Env = append(os.Environ(), envs...)
-		// type Cmd struct {
-		// Stdout io.Writer
-		// Stdout和Stderr指定进程的标准输出和标准错误输出。
-		// 如果任一个为nil，Run方法会将对应的文件描述符关联到空设备（os.DevNull）
-		// 如果两个字段相同，同一时间最多有一个线程可以写入。
-		execmd.Stdout = os.Stdout
-		// type Cmd struct {
-		// Stderr io.Writer
-		execmd.Stderr = os.Stderr
-		// type Cmd struct {
-		// Dir string
-		// Stdin指定进程的标准输入，如为nil，进程会从空设备读取（os.DevNull）
-		execmd.Dir = thePath
-		// func (c *Cmd) Run() error
-		// Run执行c包含的命令，并阻塞直到完成。
-		// 如果命令成功执行，stdin、stdout、stderr的转交没有问题，并且返回状态码为0，方法的返回值为nil；
-		// 如果命令没有执行或者执行失败，会返回*ExitError类型的错误；否则返回的error可能是表示I/O问题。
-		err = execmd.Run()
+		targets, err = parsePackTargets(packTargets, tmpdir)
 		if err != nil {
-			// func (e *Error) Error() string
 			exitPrint(err.Error())
 		}
+	}
+
+	if isOSPackage(format) {
+		if !build {
+			exitPrint(fmt.Sprintf("-f=%s needs -b=true", format))
+		}
+		for _, t := range targets {
+			if t.goos != "linux" {
+				exitPrint(fmt.Sprintf("%s packages are for linux, not %s", format, t.goos))
+			}
+		}
+	}
+
+	if build && !packList {
+		ColorLog("Building application...\n")
+		if len(targets) == 1 {
+			t := targets[0]
+			ColorLog("Env: GOOS=%s GOARCH=%s\n", t.goos, t.goarch)
+			t.compile(thePath, appName, envs, os.Stdout)
+			if t.err != nil {
+				exitPrint(t.err.Error())
+			}
+		} else {
+			// The targets build in parallel, each one writes its output to
+			// its own buffer, printed if the build fails.
+			var wg sync.WaitGroup
+			for _, t := range targets {
+				ColorLog("Env: GOOS=%s GOARCH=%s\n", t.goos, t.goarch)
+				wg.Add(1)
+				go func(t *packTarget) {
+					defer wg.Done()
+					var out bytes.Buffer
+					t.compile(thePath, appName, envs, &out)
+					if t.err != nil {
+						t.err = fmt.Errorf("%s/%s: %v\n%s", t.goos, t.goarch, t.err, out.String())
+					}
+				}(t)
+			}
+			wg.Wait()
+			for _, t := range targets {
+				if t.err != nil {
+					exitPrint(t.err.Error())
+				}
+			}
+		}
 
 		ColorLog("Build successful\n")
 	}
 
 	switch format {
-	case "zip":
+	case "zip", "tar", "tar.gz", "tar.xz", "tar.zst", "dir", "deb", "rpm":
 	default:
 		format = "tar.gz"
 	}
+	if packLevel != -1 && (format == "tar" || format == "dir" || isOSPackage(format)) {
+		ColorLog("[WARN] -l is ignored by the %s format\n", format)
+	}
+	if err := checkPackLevel(format, packLevel); err != nil {
+		exitPrint(err.Error())
+	}
 
-	outputN := appName + "." + format
+	suffix := "." + format
+	if format == "dir" {
+		suffix = "_dir"
+	}
+	outputN := appName + suffix
 
 	if outputP == "" || path.IsAbs(outputP) == false {
 		outputP = path.Join(curPath, outputP)
@@ -824,7 +1055,19 @@ func packApp(cmd *Command, args []string) int {
 		}
 	}
 
-	outputP = path.Join(outputP, outputN)
+	for _, t := range targets {
+		t.archive = path.Join(outputP, outputN)
+		if packTargets != "" {
+			t.archive = path.Join(outputP, appName+"_"+t.goos+"_"+t.goarch+suffix)
+		}
+		// The outputs of previous packs, in any format, are left out too.
+		for _, base := range []string{path.Join(outputP, appName), strings.TrimSuffix(t.archive, suffix)} {
+			for _, s := range packSuffixes {
+				packedArchives[base+s] = true
+				packedArchives[base+s+".sha256"] = true
+			}
+		}
+	}
 
 	var exp, exs []string
 	// func Split(s, sep string) []string
@@ -857,12 +1100,260 @@ func packApp(cmd *Command, args []string) int {
 			}
 		}
 	}
-	// ./pack.go
-	err = packDirectory(exp, exs, exr, tmpdir, thePath)
-	if err != nil {
-		exitPrint(err.Error())
+	// ./util.go
+	ColorLog("Excluding relpath prefix: %s\n", strings.Join(exp, ":"))
+	ColorLog("Excluding relpath suffix: %s\n", strings.Join(exs, ":"))
+	if len(exr) > 0 {
+		ColorLog("Excluding filename regex: `%s`\n", strings.Join(excludeR, "`, `"))
+	}
+	if packList {
+		if build {
+			fmt.Println(path.Base(targets[0].binPath(appName)))
+		}
+		if packBuildInfo != nil {
+			fmt.Println("VERSION\nbuild.json")
+		}
+		outputP = targets[0].archive
+		walk := new(listWalk)
+		walk.allfiles = make(map[string]bool)
+		walk.wak = walk
+		walk.excludePrefix = exp
+		walk.excludeSuffix = exs
+		walk.excludeRegexp = exr
+		if err := walkRoots(walk, []string{thePath}); err != nil {
+			exitPrint(err.Error())
+		}
+		return 0
 	}
+	for _, t := range targets {
+		outputP = t.archive
+		if isOSPackage(format) {
+			// ./pack_pkg.go
+			err = packOSPackage(exp, exs, exr, t, appName, t.tmpdir, thePath)
+		} else {
+			// ./pack.go
+			err = packDirectory(exp, exs, exr, t.tmpdir, thePath)
+		}
+		if err != nil {
+			exitPrint(err.Error())
+		}
 
-	ColorLog("Writing to output: `%s`\n", outputP)
+		ColorLog("Writing to output: `%s`\n", outputP)
+		if reproducible && format != "dir" {
+			sum, err := writeChecksum(outputP)
+			if err != nil {
+				exitPrint(err.Error())
+			}
+			ColorLog("SHA-256: %s\n", sum)
+		}
+	}
+	if packTargets != "" {
+		printPackSummary(targets)
+	}
 	return 0
 }
+
+// packTarget is a GOOS/GOARCH pair bee pack builds the app for, with the
+// results of the build.
+type packTarget struct {
+	goos      string
+	goarch    string
+	tmpdir    string // directory of the binary
+	archive   string
+	buildTime time.Duration
+	err       error
+}
+
+// parsePackTargets parses the -targets list, e.g. linux/amd64,windows/386.
+// The binary of each target goes in its own directory under tmpdir.
+func parsePackTargets(list, tmpdir string) ([]*packTarget, error) {
+	var targets []*packTarget
+	seen := make(map[string]bool)
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		parts := strings.Split(s, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid target %q, the format is GOOS/GOARCH", s)
+		}
+		seen[s] = true
+		targets = append(targets, &packTarget{
+			goos:   parts[0],
+			goarch: parts[1],
+			tmpdir: path.Join(tmpdir, parts[0]+"_"+parts[1]),
+		})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no target in %q", list)
+	}
+	return targets, nil
+}
+
+// binPath returns the path of the binary of the target.
+func (t *packTarget) binPath(appName string) string {
+	if t.goos == "windows" {
+		return path.Join(t.tmpdir, appName+".exe")
+	}
+	return path.Join(t.tmpdir, appName)
+}
+
+// compile builds the app at apppath for the target, writing the output of
+// go build to out.
+func (t *packTarget) compile(apppath, appName string, envs []string, out io.Writer) {
+	os.MkdirAll(t.tmpdir, 0700)
+	binPath := t.binPath(appName)
+
+	args := []string{"build", "-o", binPath}
+	if reproducible {
+		args = append(args, "-trimpath")
+	}
+	if len(buildArgs) > 0 {
+		// func Fields(s string) []string
+		// 返回将字符串按照空白（unicode.IsSpace确定，可以是一到多个连续的空白字符）分割的多个字符串。
+		// 如果字符串全部是空白或者是空字符串的话，会返回空切片。
+		args = append(args, strings.Fields(buildArgs)...)
+	}
+	if packBuildInfo != nil {
+		args = withLdflags(args, packBuildInfo.ldflags(conf.BuildInfo.Package))
+	}
+
+	if verbose {
+		// func Fprintf(w io.Writer, format string, a ...interface{}) (n int, err error)
+		// Fprintf根据format参数生成格式化的字符串并写入w。返回写入的字节数和遇到的任何错误。
+		fmt.Fprintf(w, "\t%s%s+ GOOS=%s GOARCH=%s go %s%s%s\n", "\x1b[32m", "\x1b[1m", t.goos, t.goarch, strings.Join(args, " "), "\x1b[21m", "\x1b[0m")
+	}
+
+	// func Command(name string, arg ...string) *Cmd
+	// 函数返回一个*Cmd，用于使用给出的参数执行name指定的程序。
+	execmd := exec.Command("go", args...)
+	// type Cmd struct {
+	// Env []string
+	// Env指定进程的环境，如为nil，则是在当前进程的环境下执行。
+	execmd.Env = append(os.Environ(), envs...)
+	execmd.Env = append(execmd.Env, "GOOS="+t.goos, "GOARCH="+t.goarch)
+	execmd.Stdout = out
+	execmd.Stderr = out
+	execmd.Dir = apppath
+
+	start := time.Now()
+	t.err = execmd.Run()
+	t.buildTime = time.Since(start)
+	if t.err == nil && packBuildInfo != nil {
+		t.err = packBuildInfo.writeManifest(t.tmpdir, t.goos, t.goarch)
+	}
+}
+
+// printPackSummary prints the size of the archive and the build time of
+// each target.
+func printPackSummary(targets []*packTarget) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tTARGET\tARCHIVE\tSIZE\tBUILD TIME")
+	for _, t := range targets {
+		size := "-"
+		if fi, err := os.Stat(t.archive); err == nil && !fi.IsDir() {
+			size = formatSize(fi.Size())
+		} else if err == nil {
+			var n int64
+			path.Walk(t.archive, func(_ string, fi os.FileInfo, err error) error {
+				if err == nil && fi.Mode().IsRegular() {
+					n += fi.Size()
+				}
+				return nil
+			})
+			size = formatSize(n)
+		}
+		fmt.Fprintf(tw, "\t%s/%s\t%s\t%s\t%.1fs\n", t.goos, t.goarch, path.Base(t.archive), size, t.buildTime.Seconds())
+	}
+	tw.Flush()
+}
+
+// formatSize returns n bytes in B, KB or MB.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// sourceDateEpoch returns the time of SOURCE_DATE_EPOCH, or of the last git
+// commit of the app at apppath, or 1980-01-01, the earliest time zip can
+// store.
+func sourceDateEpoch(apppath string) (time.Time, error) {
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", v)
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	execmd := exec.Command("git", "log", "-1", "--format=%ct")
+	execmd.Dir = apppath
+	if out, err := execmd.Output(); err == nil {
+		if sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC(), nil
+		}
+	}
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// normalizedMode returns 0755 for directories and executables, 0644 for
+// other files, symbolic links keep their type.
+func normalizedMode(mode os.FileMode) os.FileMode {
+	if mode&os.ModeSymlink != 0 {
+		return os.ModeSymlink | 0777
+	}
+	if mode.IsDir() {
+		return os.ModeDir | 0755
+	}
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// normalizeTarHeader removes from hdr what depends on the machine packing
+// the app rather than on the sources.
+func normalizeTarHeader(hdr *tar.Header) {
+	hdr.ModTime = packModTime
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	mode := os.FileMode(hdr.Mode & 0777)
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		mode |= os.ModeSymlink
+	case tar.TypeDir:
+		mode |= os.ModeDir
+	}
+	hdr.Mode = int64(normalizedMode(mode).Perm())
+}
+
+// normalizeZipHeader removes from hdr what depends on the machine packing
+// the app rather than on the sources.
+func normalizeZipHeader(hdr *zip.FileHeader) {
+	hdr.Modified = packModTime
+	hdr.SetMode(normalizedMode(hdr.Mode()))
+}
+
+// writeChecksum writes the SHA-256 of the file fpath to fpath.sha256, in
+// the format of sha256sum, and returns it.
+func writeChecksum(fpath string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer CloseFile(f)
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	line := sum + "  " + path.Base(fpath) + "\n"
+	return sum, ioutil.WriteFile(fpath+".sha256", []byte(line), 0644)
+}
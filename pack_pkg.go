@@ -0,0 +1,414 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/rpmpack"
+)
+
+// pkgMeta is the metadata of the deb and rpm packages of bee pack, from
+// "package" in bee.json.
+type pkgMeta struct {
+	Name        string
+	Version     string
+	Release     string
+	Maintainer  string
+	Description string
+	Homepage    string
+	License     string
+	Depends     []string
+	User        string // user running the service, root if empty
+}
+
+// packageMeta returns the package metadata of bee.json, with the defaults
+// of the app appName.
+func packageMeta(appName string) pkgMeta {
+	m := pkgMeta(conf.Package)
+	if m.Name == "" {
+		m.Name = appName
+	}
+	if m.Version == "" {
+		m.Version = "0.1.0"
+	}
+	if m.Release == "" {
+		m.Release = "1"
+	}
+	if m.Maintainer == "" {
+		m.Maintainer = "root <root@localhost>"
+	}
+	if m.Description == "" {
+		m.Description = appName + ", a beego application"
+	}
+	return m
+}
+
+// pkgFile is a file of a deb or rpm package. Exactly one of src, body and
+// link is set.
+type pkgFile struct {
+	dst  string // absolute path once installed
+	src  string
+	body []byte
+	link string
+	mode os.FileMode
+	conf bool // configuration file, kept on upgrade if modified
+}
+
+// pkgWalk collects the files bee pack includes, to lay them out as a
+// package: the binary and the app files under /opt/<app>, the conf
+// directory under /etc/<app>.
+type pkgWalk struct {
+	walkFileTree
+	app   string
+	files []pkgFile
+}
+
+func (wft *pkgWalk) compress(name, fpath string, fi os.FileInfo) (bool, error) {
+	f := pkgFile{dst: "/opt/" + wft.app + "/" + name, src: fpath, mode: fi.Mode().Perm()}
+	if strings.HasPrefix(name, "conf/") {
+		f.dst = "/etc/" + wft.app + "/" + strings.TrimPrefix(name, "conf/")
+		f.conf = true
+	}
+	if fi.Mode()&os.ModeSymlink > 0 {
+		link, err := os.Readlink(fpath)
+		if err != nil {
+			return false, err
+		}
+		f.src, f.link = "", link
+	}
+	if reproducible {
+		f.mode = normalizedMode(fi.Mode()).Perm()
+	}
+	wft.files = append(wft.files, f)
+	return true, nil
+}
+
+var debArchs = map[string]string{"amd64": "amd64", "386": "i386", "arm64": "arm64", "arm": "armhf", "ppc64le": "ppc64el", "s390x": "s390x"}
+
+var rpmArchs = map[string]string{"amd64": "x86_64", "386": "i386", "arm64": "aarch64", "arm": "armv7hl", "ppc64le": "ppc64le", "s390x": "s390x"}
+
+// packOSPackage writes the deb or rpm package of the target t of the app
+// appName, with the files under includePath bee pack includes.
+func packOSPackage(excludePrefix []string, excludeSuffix []string,
+	excludeRegexp []*regexp.Regexp, t *packTarget, appName string, includePath ...string) error {
+	if t.goos != "linux" {
+		return fmt.Errorf("%s packages are for linux, not %s", format, t.goos)
+	}
+	archs := debArchs
+	if format == "rpm" {
+		archs = rpmArchs
+	}
+	arch, ok := archs[t.goarch]
+	if !ok {
+		return fmt.Errorf("%s packages do not support %s", format, t.goarch)
+	}
+
+	walk := new(pkgWalk)
+	walk.allfiles = make(map[string]bool)
+	walk.app = appName
+	walk.wak = walk
+	walk.excludePrefix = excludePrefix
+	walk.excludeSuffix = excludeSuffix
+	walk.excludeRegexp = excludeRegexp
+	if err := walkRoots(walk, includePath); err != nil {
+		return err
+	}
+
+	meta := packageMeta(appName)
+	files := walk.files
+	for _, f := range files {
+		if f.conf {
+			// beego reads conf/app.conf from its working directory
+			files = append(files, pkgFile{dst: "/opt/" + appName + "/conf", link: "/etc/" + appName, mode: 0777})
+			break
+		}
+	}
+	unitDir := "/lib/systemd/system/"
+	if format == "rpm" {
+		unitDir = "/usr/lib/systemd/system/"
+	}
+	files = append(files, pkgFile{dst: unitDir + appName + ".service", body: []byte(systemdUnit(appName, meta)), mode: 0644})
+	sort.Slice(files, func(i, j int) bool { return files[i].dst < files[j].dst })
+
+	mtime := time.Now()
+	if reproducible {
+		mtime = packModTime
+	}
+
+	fw, err := os.OpenFile(outputP, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer CloseFile(fw)
+	if format == "rpm" {
+		return writeRpm(fw, files, meta, arch, appName, mtime)
+	}
+	return writeDeb(fw, files, meta, arch, appName, mtime)
+}
+
+// systemdUnit returns the service file running the app appName.
+func systemdUnit(appName string, meta pkgMeta) string {
+	user := ""
+	if meta.User != "" {
+		user = "User=" + meta.User + "\n"
+	}
+	content := strings.Replace(systemdUnitTpl, "{{description}}", meta.Description, -1)
+	content = strings.Replace(content, "{{user}}", user, -1)
+	return strings.Replace(content, "{{appName}}", appName, -1)
+}
+
+// pkgScripts returns the scripts run after the package is installed and
+// before it is removed. removing is the shell test telling a removal
+// from an upgrade.
+func pkgScripts(appName string, meta pkgMeta, removing string) (string, string) {
+	postinst := "if command -v systemctl >/dev/null 2>&1; then\n\tsystemctl daemon-reload\n\tsystemctl enable " + appName + ".service\nfi\n"
+	if meta.User != "" && meta.User != "root" {
+		postinst = "id -u " + meta.User + " >/dev/null 2>&1 || useradd --system --no-create-home --shell /sbin/nologin " + meta.User + "\n" + postinst
+	}
+	prerm := "if " + removing + " && command -v systemctl >/dev/null 2>&1; then\n\tsystemctl stop " + appName + ".service || true\n\tsystemctl disable " + appName + ".service || true\nfi\n"
+	return postinst, prerm
+}
+
+func readPkgFile(f pkgFile) ([]byte, error) {
+	if f.src != "" {
+		return ioutil.ReadFile(f.src)
+	}
+	return f.body, nil
+}
+
+// writeDeb writes a deb package: an ar archive of debian-binary,
+// control.tar.gz and data.tar.gz.
+func writeDeb(w io.Writer, files []pkgFile, meta pkgMeta, arch, appName string, mtime time.Time) error {
+	var data bytes.Buffer
+	var md5sums, conffiles []string
+	var size int64
+	gw := gzip.NewWriter(&data)
+	tw := tar.NewWriter(gw)
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		// dpkg wants the parents of each file in the archive first
+		var parents []string
+		for dir := path.Dir(f.dst); dir != "/" && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			parents = append([]string{dir}, parents...)
+		}
+		for _, dir := range parents {
+			hdr := &tar.Header{Name: "." + dir + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime, Uname: "root", Gname: "root"}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+		}
+
+		hdr := &tar.Header{Name: "." + f.dst, Mode: int64(f.mode), ModTime: mtime, Uname: "root", Gname: "root"}
+		if f.link != "" {
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, f.link
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			continue
+		}
+		body, err := readPkgFile(f)
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag, hdr.Size = tar.TypeReg, int64(len(body))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(body); err != nil {
+			return err
+		}
+		sum := md5.Sum(body)
+		md5sums = append(md5sums, hex.EncodeToString(sum[:])+"  "+f.dst[1:])
+		size += int64(len(body))
+		if f.conf {
+			conffiles = append(conffiles, f.dst)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	control := "Package: " + meta.Name + "\n" +
+		"Version: " + meta.Version + "-" + meta.Release + "\n" +
+		"Architecture: " + arch + "\n" +
+		"Maintainer: " + meta.Maintainer + "\n" +
+		"Installed-Size: " + strconv.FormatInt((size+1023)/1024, 10) + "\n" +
+		"Section: misc\n" +
+		"Priority: optional\n"
+	if len(meta.Depends) > 0 {
+		control += "Depends: " + strings.Join(meta.Depends, ", ") + "\n"
+	}
+	if meta.Homepage != "" {
+		control += "Homepage: " + meta.Homepage + "\n"
+	}
+	control += "Description: " + meta.Description + "\n"
+
+	postinst, prerm := pkgScripts(appName, meta, `[ "$1" = remove ]`)
+	entries := []pkgFile{
+		{dst: "control", body: []byte(control), mode: 0644},
+		{dst: "md5sums", body: []byte(strings.Join(md5sums, "\n") + "\n"), mode: 0644},
+		{dst: "postinst", body: []byte("#!/bin/sh\nset -e\n" + postinst), mode: 0755},
+		{dst: "prerm", body: []byte("#!/bin/sh\nset -e\n" + prerm), mode: 0755},
+	}
+	if len(conffiles) > 0 {
+		entries = append(entries, pkgFile{dst: "conffiles", body: []byte(strings.Join(conffiles, "\n") + "\n"), mode: 0644})
+	}
+	var ctrl bytes.Buffer
+	gw = gzip.NewWriter(&ctrl)
+	tw = tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: "./" + e.dst, Typeflag: tar.TypeReg, Mode: int64(e.mode), Size: int64(len(e.body)), ModTime: mtime, Uname: "root", Gname: "root"}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.body); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "!<arch>\n"); err != nil {
+		return err
+	}
+	for _, m := range []struct {
+		name string
+		body []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", ctrl.Bytes()},
+		{"data.tar.gz", data.Bytes()},
+	} {
+		if err := writeArEntry(w, m.name, m.body, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArEntry writes the file name of an ar archive, padded to an even
+// size.
+func writeArEntry(w io.Writer, name string, body []byte, mtime time.Time) error {
+	hdr := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, mtime.Unix(), 0, 0, "100644", len(body))
+	if _, err := io.WriteString(w, hdr); err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if len(body)%2 == 1 {
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	return nil
+}
+
+// writeRpm writes an rpm package.
+func writeRpm(w io.Writer, files []pkgFile, meta pkgMeta, arch, appName string, mtime time.Time) error {
+	rm := rpmpack.RPMMetaData{
+		Name:        meta.Name,
+		Version:     meta.Version,
+		Release:     meta.Release,
+		Arch:        arch,
+		OS:          "linux",
+		Summary:     meta.Description,
+		Description: meta.Description,
+		Packager:    meta.Maintainer,
+		URL:         meta.Homepage,
+		Licence:     meta.License,
+		BuildTime:   mtime,
+	}
+	for _, d := range meta.Depends {
+		if err := rm.Requires.Set(d); err != nil {
+			return err
+		}
+	}
+	r, err := rpmpack.NewRPM(rm)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		rf := rpmpack.RPMFile{Name: f.dst, Mode: uint(f.mode) | 0100000, Owner: "root", Group: "root", MTime: uint32(mtime.Unix())}
+		switch {
+		case f.link != "":
+			rf.Mode, rf.Body = 0120777, []byte(f.link)
+		default:
+			if rf.Body, err = readPkgFile(f); err != nil {
+				return err
+			}
+		}
+		if f.conf {
+			rf.Type = rpmpack.ConfigFile
+		}
+		r.AddFile(rf)
+	}
+	postinst, prerm := pkgScripts(appName, meta, `[ "$1" -eq 0 ]`)
+	r.AddPostin("set -e\n" + postinst)
+	r.AddPreun("set -e\n" + prerm)
+	return r.Write(w)
+}
+
+// isOSPackage tells if format is a package of a Linux distribution.
+func isOSPackage(format string) bool {
+	return format == "deb" || format == "rpm"
+}
+
+// loadPackConf loads bee.json or Beefile of the app at apppath, for the
+// package metadata and the build information.
+func loadPackConf(apppath string) {
+	curPath, _ := os.Getwd()
+	os.Chdir(apppath)
+	defer os.Chdir(curPath)
+	if err := loadConfig(); err != nil {
+		exitPrint(fmt.Sprintf("Fail to parse bee.json: %s", err))
+	}
+}
+
+var systemdUnitTpl = `[Unit]
+Description={{description}}
+After=network.target
+
+[Service]
+Type=simple
+{{user}}WorkingDirectory=/opt/{{appName}}
+ExecStart=/opt/{{appName}}/{{appName}}
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readArchive returns the entries of a tar.gz archive, by name. The body of
+// a symlink is its target.
+func readArchive(t *testing.T, data []byte) map[string]string {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			entries[hdr.Name] = "-> " + hdr.Linkname
+			continue
+		}
+		body, _ := ioutil.ReadAll(tr)
+		entries[hdr.Name] = string(body)
+	}
+	return entries
+}
+
+// packTestApp packs a small app in format, reproducibly, and returns the
+// package.
+func packTestApp(t *testing.T, pkgFormat string) []byte {
+	root := t.TempDir()
+	bin := filepath.Join(root, "bin")
+	app := filepath.Join(root, "myapp")
+	for name, content := range map[string]string{
+		filepath.Join(bin, "myapp"):                  "binary",
+		filepath.Join(app, "main.go"):                "package main\n",
+		filepath.Join(app, "conf", "app.conf"):       "appname = myapp\n",
+		filepath.Join(app, "static", "css", "a.css"): "body {}\n",
+		filepath.Join(app, "views", "index.tpl"):     "<h1>myapp</h1>\n",
+	} {
+		os.MkdirAll(filepath.Dir(name), 0755)
+		ioutil.WriteFile(name, []byte(content), 0644)
+	}
+
+	defer func(f, o string, r bool, m time.Time) {
+		format, outputP, reproducible, packModTime = f, o, r, m
+	}(format, outputP, reproducible, packModTime)
+	format, outputP = pkgFormat, filepath.Join(root, "myapp."+pkgFormat)
+	reproducible, packModTime = true, time.Unix(1600000000, 0)
+
+	target := &packTarget{goos: "linux", goarch: "amd64"}
+	if err := packOSPackage([]string{"."}, []string{".go"}, nil, target, "myapp", bin, app); err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := ioutil.ReadFile(outputP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+func TestPackDeb(t *testing.T) {
+	deb := packTestApp(t, "deb")
+
+	// ar layout: the magic, then debian-binary, control.tar.gz and data.tar.gz
+	if !bytes.HasPrefix(deb, []byte("!<arch>\n")) {
+		t.Fatalf("no ar magic: %q", deb[:8])
+	}
+	members := make(map[string][]byte)
+	var names []string
+	for rest := deb[8:]; len(rest) > 0; {
+		if len(rest) < 60 || string(rest[58:60]) != "`\n" {
+			t.Fatalf("bad ar header at %d", len(deb)-len(rest))
+		}
+		name := strings.TrimSpace(string(rest[:16]))
+		if mtime := strings.TrimSpace(string(rest[16:28])); mtime != "1600000000" {
+			t.Errorf("%s: mtime %s", name, mtime)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(string(rest[48:58])))
+		if err != nil {
+			t.Fatalf("%s: size: %v", name, err)
+		}
+		names = append(names, name)
+		members[name] = rest[60 : 60+size]
+		rest = rest[60+size+size%2:]
+	}
+	if got := strings.Join(names, ","); got != "debian-binary,control.tar.gz,data.tar.gz" {
+		t.Fatalf("ar members: %s", got)
+	}
+	if string(members["debian-binary"]) != "2.0\n" {
+		t.Errorf("debian-binary: %q", members["debian-binary"])
+	}
+
+	control := readArchive(t, members["control.tar.gz"])
+	for _, want := range []string{"Package: myapp\n", "Version: 0.1.0-1\n", "Architecture: amd64\n", "Description: myapp, a beego application\n"} {
+		if !strings.Contains(control["./control"], want) {
+			t.Errorf("control has no %q:\n%s", want, control["./control"])
+		}
+	}
+	if got := control["./conffiles"]; got != "/etc/myapp/app.conf\n" {
+		t.Errorf("conffiles: %q", got)
+	}
+	sum := md5.Sum([]byte("appname = myapp\n"))
+	if want := hex.EncodeToString(sum[:]) + "  etc/myapp/app.conf\n"; !strings.Contains(control["./md5sums"], want) {
+		t.Errorf("md5sums has no %q:\n%s", want, control["./md5sums"])
+	}
+	if n := strings.Count(control["./md5sums"], "\n"); n != 5 {
+		t.Errorf("md5sums has %d lines, want 5:\n%s", n, control["./md5sums"])
+	}
+
+	data := readArchive(t, members["data.tar.gz"])
+	for name, want := range map[string]string{
+		"./opt/myapp/myapp":            "binary",
+		"./opt/myapp/conf":             "-> /etc/myapp",
+		"./etc/myapp/app.conf":         "appname = myapp\n",
+		"./opt/myapp/static/css/a.css": "body {}\n",
+		"./opt/myapp/views/index.tpl":  "<h1>myapp</h1>\n",
+	} {
+		got, ok := data[name]
+		if !ok {
+			t.Errorf("%s missing from data.tar.gz", name)
+		} else if got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if !strings.Contains(data["./lib/systemd/system/myapp.service"], "ExecStart=/opt/myapp/myapp") {
+		t.Errorf("service file:\n%s", data["./lib/systemd/system/myapp.service"])
+	}
+	if _, ok := data["./opt/myapp/main.go"]; ok {
+		t.Error("main.go should be excluded")
+	}
+
+	if _, err := exec.LookPath("dpkg-deb"); err == nil {
+		fpath := filepath.Join(t.TempDir(), "myapp.deb")
+		ioutil.WriteFile(fpath, deb, 0644)
+		for _, flag := range []string{"-I", "-c"} {
+			if out, err := exec.Command("dpkg-deb", flag, fpath).CombinedOutput(); err != nil {
+				t.Errorf("dpkg-deb %s: %v\n%s", flag, err, out)
+			}
+		}
+	}
+}
+
+// rpmHeader returns the string and int32 entries of the main header of an
+// rpm package, by tag: the lead, the signature header and its padding come
+// first.
+func rpmHeader(t *testing.T, rpm []byte) (map[int][]string, map[int][]int32) {
+	if len(rpm) < 96 || !bytes.Equal(rpm[:4], []byte{0xed, 0xab, 0xee, 0xdb}) {
+		t.Fatal("no rpm lead")
+	}
+	// header returns the index entries and the data of the header at off,
+	// and the offset following it
+	header := func(off int) ([]byte, []byte, int) {
+		if len(rpm) < off+16 || !bytes.Equal(rpm[off:off+3], []byte{0x8e, 0xad, 0xe8}) {
+			t.Fatalf("no header at %d", off)
+		}
+		n := int(binary.BigEndian.Uint32(rpm[off+8:]))
+		size := int(binary.BigEndian.Uint32(rpm[off+12:]))
+		index := rpm[off+16 : off+16+16*n]
+		return index, rpm[off+16+16*n : off+16+16*n+size], off + 16 + 16*n + size
+	}
+	_, _, next := header(96)
+	next += (8 - next%8) % 8
+	index, data, _ := header(next)
+
+	strs, ints := make(map[int][]string), make(map[int][]int32)
+	for i := 0; i < len(index); i += 16 {
+		tag := int(binary.BigEndian.Uint32(index[i:]))
+		typ := binary.BigEndian.Uint32(index[i+4:])
+		off := int(binary.BigEndian.Uint32(index[i+8:]))
+		count := int(binary.BigEndian.Uint32(index[i+12:]))
+		switch typ {
+		case 4: // int32
+			for j := 0; j < count; j++ {
+				ints[tag] = append(ints[tag], int32(binary.BigEndian.Uint32(data[off+4*j:])))
+			}
+		case 6, 8, 9: // string, string array, i18n string
+			for j := 0; j < count; j++ {
+				end := bytes.IndexByte(data[off:], 0)
+				strs[tag] = append(strs[tag], string(data[off:off+end]))
+				off += end + 1
+			}
+		}
+	}
+	return strs, ints
+}
+
+func TestPackRpm(t *testing.T) {
+	const (
+		tagName       = 1000
+		tagVersion    = 1001
+		tagRelease    = 1002
+		tagArch       = 1022
+		tagPostin     = 1024
+		tagPreun      = 1025
+		tagFileFlags  = 1037
+		tagDirIndexes = 1116
+		tagBaseNames  = 1117
+		tagDirNames   = 1118
+	)
+	strs, ints := rpmHeader(t, packTestApp(t, "rpm"))
+
+	for tag, want := range map[int]string{tagName: "myapp", tagVersion: "0.1.0", tagRelease: "1", tagArch: "x86_64"} {
+		if got := strings.Join(strs[tag], ","); got != want {
+			t.Errorf("tag %d: got %q, want %q", tag, got, want)
+		}
+	}
+	for _, tag := range []int{tagPostin, tagPreun} {
+		if got := strings.Join(strs[tag], ""); !strings.HasPrefix(got, "set -e\n") || !strings.Contains(got, "myapp.service") {
+			t.Errorf("scriptlet %d:\n%s", tag, got)
+		}
+	}
+
+	var files []string
+	conf := ""
+	for i, base := range strs[tagBaseNames] {
+		name := strs[tagDirNames][ints[tagDirIndexes][i]] + base
+		files = append(files, name)
+		// RPMFILE_CONFIG
+		if ints[tagFileFlags][i]&1 != 0 {
+			conf += name
+		}
+	}
+	sort.Strings(files)
+	want := "/etc/myapp/app.conf,/opt/myapp/conf,/opt/myapp/myapp,/opt/myapp/static/css/a.css,/opt/myapp/views/index.tpl,/usr/lib/systemd/system/myapp.service"
+	if got := strings.Join(files, ","); got != want {
+		t.Errorf("files:\n%s\nwant\n%s", got, want)
+	}
+	if conf != "/etc/myapp/app.conf" {
+		t.Errorf("config files: %s", conf)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePackTargets(t *testing.T) {
+	targets, err := parsePackTargets(" linux/amd64, linux/arm64,,linux/amd64,windows/386", "/tmp/pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tg := range targets {
+		got = append(got, tg.goos+"/"+tg.goarch+" "+tg.tmpdir)
+	}
+	want := "linux/amd64 /tmp/pack/linux_amd64,linux/arm64 /tmp/pack/linux_arm64,windows/386 /tmp/pack/windows_386"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, ","), want)
+	}
+	if tg := targets[2]; tg.binPath("myapp") != "/tmp/pack/windows_386/myapp.exe" {
+		t.Errorf("windows binary: %s", tg.binPath("myapp"))
+	}
+
+	for _, list := range []string{"", " , ", "linux", "linux/", "/amd64", "linux/amd64/v2", "linux/amd64,darwin"} {
+		if _, err := parsePackTargets(list, "/tmp/pack"); err == nil {
+			t.Errorf("%q should be rejected", list)
+		}
+	}
+}
+
+func TestPackReproducible(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "myapp")
+	for name, content := range map[string]string{
+		"conf/app.conf":    "appname = myapp\n",
+		"static/css/a.css": "body {}\n",
+		"views/index.tpl":  "<h1>myapp</h1>\n",
+		"myapp":            "binary",
+	} {
+		os.MkdirAll(filepath.Dir(filepath.Join(app, name)), 0755)
+		ioutil.WriteFile(filepath.Join(app, name), []byte(content), 0644)
+	}
+
+	defer func(f, o string, r bool, m time.Time, l int) {
+		format, outputP, reproducible, packModTime, packLevel = f, o, r, m, l
+	}(format, outputP, reproducible, packModTime, packLevel)
+	reproducible, packModTime, packLevel = true, time.Unix(1600000000, 0).UTC(), -1
+
+	for _, f := range []string{"tar.gz", "zip"} {
+		format = f
+		var outputs [2][]byte
+		for i := range outputs {
+			// what differs between two checkouts of the same commit
+			mtime := time.Now().Add(time.Duration(i) * time.Hour)
+			filepath.Walk(app, func(fpath string, _ os.FileInfo, _ error) error {
+				return os.Chtimes(fpath, mtime, mtime)
+			})
+			os.Chmod(filepath.Join(app, "views", "index.tpl"), os.FileMode(0644-i*0040))
+
+			outputP = filepath.Join(root, "myapp"+strings.Repeat("2", i)+"."+f)
+			if err := packDirectory([]string{"."}, []string{".go"}, nil, app); err != nil {
+				t.Fatal(err)
+			}
+			outputs[i], _ = ioutil.ReadFile(outputP)
+		}
+		if len(outputs[0]) == 0 || !bytes.Equal(outputs[0], outputs[1]) {
+			t.Errorf("%s: the archives of the same files differ", f)
+		}
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1600000000")
+	if tm, err := sourceDateEpoch(t.TempDir()); err != nil || tm.Unix() != 1600000000 {
+		t.Errorf("got %v, %v", tm, err)
+	}
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := sourceDateEpoch(t.TempDir()); err == nil {
+		t.Error("an invalid SOURCE_DATE_EPOCH should fail")
+	}
+	os.Setenv("SOURCE_DATE_EPOCH", "")
+	if tm, _ := sourceDateEpoch(t.TempDir()); tm.Year() != 1980 {
+		t.Errorf("outside git: got %v, want 1980-01-01", tm)
+	}
+}
+
+func TestCheckPackLevel(t *testing.T) {
+	cases := []struct {
+		format string
+		level  int
+		ok     bool
+	}{
+		{"tar.gz", -1, true},
+		{"tar.gz", 0, true},
+		{"tar.gz", 9, true},
+		{"tar.gz", 10, false},
+		{"tar.gz", -2, false},
+		{"zip", 9, true},
+		{"zip", 10, false},
+		{"tar.xz", 0, true},
+		{"tar.xz", 9, true},
+		{"tar.xz", 10, false},
+		{"tar.zst", -1, true},
+		{"tar.zst", 0, false},
+		{"tar.zst", 1, true},
+		{"tar.zst", 22, true},
+		{"tar.zst", 23, false},
+		{"tar", 42, true},
+		{"dir", 42, true},
+		{"deb", 42, true},
+		{"rpm", 42, true},
+	}
+	for _, c := range cases {
+		if err := checkPackLevel(c.format, c.level); (err == nil) != c.ok {
+			t.Errorf("%s level %d: got %v", c.format, c.level, err)
+		}
+	}
+}
+
+func TestPackDir(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "myapp")
+	os.MkdirAll(filepath.Join(app, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(app, "conf", "app.conf"), []byte("appname = myapp\n"), 0644)
+	ioutil.WriteFile(filepath.Join(app, "main.go"), []byte("package main\n"), 0644)
+	ioutil.WriteFile(filepath.Join(app, "myapp"), []byte("binary"), 0755)
+	os.Symlink("conf/app.conf", filepath.Join(app, "app.conf"))
+
+	defer func(f, o string) { format, outputP = f, o }(format, outputP)
+	format, outputP = "dir", filepath.Join(root, "myapp_dir")
+	// a previous output is replaced
+	os.MkdirAll(filepath.Join(outputP, "stale"), 0755)
+	if err := packDirectory([]string{"."}, []string{".go"}, nil, app); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	filepath.Walk(outputP, func(fpath string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			rel, _ := filepath.Rel(outputP, fpath)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if strings.Join(got, ",") != "app.conf,conf/app.conf,myapp" {
+		t.Errorf("files: %s", strings.Join(got, ","))
+	}
+	if link, err := os.Readlink(filepath.Join(outputP, "app.conf")); err != nil || link != "conf/app.conf" {
+		t.Errorf("symlink: %q, %v", link, err)
+	}
+	if fi, err := os.Stat(filepath.Join(outputP, "myapp")); err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("binary mode: %v, %v", fi, err)
+	}
+
+	ioutil.WriteFile(filepath.Join(root, "file"), nil, 0644)
+	outputP = filepath.Join(root, "file")
+	if err := packDirectory([]string{"."}, []string{".go"}, nil, app); err == nil {
+		t.Error("packing to a file that is not a directory should fail")
+	}
+}
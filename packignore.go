@@ -0,0 +1,192 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignorePattern is a line of a .beepackignore or .gitignore file.
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules are the .beepackignore files, and optionally the .gitignore
+// files, of the directory root and of its subdirectories. As with git, the
+// last matching pattern decides, patterns of a subdirectory are relative
+// to it and come after those of its parents, and what is inside an
+// excluded directory can not be included again.
+type ignoreRules struct {
+	root  string
+	files []string // names of the ignore files, the last one wins
+	dirs  map[string][]ignorePattern
+}
+
+// newIgnoreRules returns the rules of the ignore files named files under
+// root.
+func newIgnoreRules(root string, files ...string) *ignoreRules {
+	return &ignoreRules{root: root, files: files, dirs: make(map[string][]ignorePattern)}
+}
+
+// patterns returns the patterns of the ignore files of the directory dir,
+// relative to root.
+func (r *ignoreRules) patterns(dir string) []ignorePattern {
+	if ps, ok := r.dirs[dir]; ok {
+		return ps
+	}
+	var ps []ignorePattern
+	for _, name := range r.files {
+		content, err := ioutil.ReadFile(filepath.Join(r.root, filepath.FromSlash(dir), name))
+		if err == nil {
+			ps = append(ps, parseIgnore(string(content))...)
+		}
+	}
+	r.dirs[dir] = ps
+	return ps
+}
+
+// isIgnored tells if the path rel, relative to root and separated by
+// slashes, is excluded.
+func (r *ignoreRules) isIgnored(rel string, isDir bool) bool {
+	ignored := false
+	dir := ""
+	for {
+		name := strings.TrimPrefix(rel, dir)
+		for _, p := range r.patterns(strings.TrimSuffix(dir, "/")) {
+			if p.dirOnly && !isDir {
+				continue
+			}
+			if p.re.MatchString(name) {
+				ignored = !p.negate
+			}
+		}
+		i := strings.Index(name, "/")
+		if i < 0 {
+			return ignored
+		}
+		dir += name[:i+1]
+	}
+}
+
+// parseIgnore parses the patterns of an ignore file, which follow the
+// syntax of .gitignore.
+func parseIgnore(content string) []ignorePattern {
+	var ps []ignorePattern
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		// trailing spaces are ignored unless escaped
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var p ignorePattern
+		if line[0] == '!' {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		// a pattern with a slash other than a trailing one is relative to
+		// the directory of the file, otherwise it matches at any depth
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		expr := globRegexp(line)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "^(?:.*/)?" + expr + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			ColorLog("[WARN] Invalid ignore pattern '%s': %s\n", line, err)
+			continue
+		}
+		p.re = re
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// globRegexp returns the regular expression of the glob pattern, where *
+// and ? do not match slashes and ** matches any number of directories.
+func globRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case pattern[i:] == "**" && (i == 0 || pattern[i-1] == '/'):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			j := strings.IndexByte(pattern[i+1:], ']')
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += j + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// ignoreFiles returns the names of the ignore files bee pack reads.
+func ignoreFiles(gitignore bool) []string {
+	if gitignore {
+		return []string{".gitignore", ".beepackignore"}
+	}
+	return []string{".beepackignore"}
+}
+
+// isIgnored tells if the file fpath is excluded by the ignore files of
+// bee pack. They apply to the app only, not to the binary built in a
+// temporary directory.
+func (wft *walkFileTree) isIgnored(fpath string, isDir bool) bool {
+	if packIgnore == nil || wft.prefix != packIgnore.root {
+		return false
+	}
+	rel := wft.virPath(fpath)
+	return rel != "" && packIgnore.isIgnored(rel, isDir)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	root, err := ioutil.TempDir("", "beepackignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "static", "js"), 0755)
+	ioutil.WriteFile(filepath.Join(root, ".beepackignore"), []byte(`# comment
+*.log
+!keep.log
+/tmp/
+logs/
+static/**/*.map
+docs/**
+\#hash
+`), 0644)
+	ioutil.WriteFile(filepath.Join(root, "static", ".beepackignore"), []byte("/js/vendor.js\n"), 0644)
+
+	cases := []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"app.log", false, true},
+		{"views/app.log", false, true},
+		{"keep.log", false, false},
+		{"tmp", true, true},
+		{"tmp", false, false},
+		{"views/tmp", true, false},
+		{"logs", true, true},
+		{"views/logs", true, true},
+		{"static/app.js.map", false, true},
+		{"static/js/app.js.map", false, true},
+		{"static/js/app.js", false, false},
+		{"static/js/vendor.js", false, true},
+		{"js/vendor.js", false, false},
+		{"docs/a/b.md", false, true},
+		{"docs", true, false},
+		{"#hash", false, true},
+		{"conf/app.conf", false, false},
+	}
+	r := newIgnoreRules(root, ".beepackignore")
+	for _, c := range cases {
+		if got := r.isIgnored(c.rel, c.isDir); got != c.ignored {
+			t.Errorf("%s (dir %v): got %v, want %v", c.rel, c.isDir, got, c.ignored)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	path "path/filepath" // 实现了兼容各操作系统的文件路径的实用操作函数。别名定义为path
 	"runtime" // 提供和go运行时环境的互操作
 	"strings" // 操作字符串简单方法
+	"time" // 时间的显示和测量
 )
 
 var cmdRun = &Command{
@@ -144,6 +145,10 @@ func runApp(cmd *Command, args []string) int {
 	if err != nil {
 		ColorLog("[ERRO] Fail to parse bee.json[ %s ]\n", err)
 	}
+	if !conf.BuildInfo.Disable {
+		// ./buildinfo.go
+		runBuildInfo = readBuildInfo(currpath, time.Now())
+	}
 
 	var paths []string
 	readAppDirectories(currpath, &paths)
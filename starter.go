@@ -0,0 +1,653 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings" // 操作字符的简单函数
+	"text/template"
+)
+
+// appStarter is the layout bee new writes for -template.
+type appStarter struct {
+	// Name prefixes the names of the user templates overriding the files,
+	// e.g. api for api/main.go.tpl. Starters read from a directory have no
+	// name, their files are final.
+	Name  string
+	Conf  string // conf/app.conf in ini format, {{.Appname}} is the app name
+	Dirs  []string
+	Files []starterFile
+}
+
+// starterFile is a file of a starter or a feature. {{.Appname}} in the
+// content of built-in files is replaced with the package path of the app.
+type starterFile struct {
+	Path    string // slash separated, relative to the app
+	Content string
+}
+
+// appFeature is an option of bee new -with.
+type appFeature struct {
+	Conf  string // lines appended to conf/app.conf
+	Setup string // function defined in Files, called first thing in main
+	Dirs  []string
+	Files []starterFile
+	Write func(apppath string, data *AppTemplateData) // writes files once the app is in place
+}
+
+var appStarters = map[string]*appStarter{
+	"web": {
+		Name: "new",
+		Conf: appconf,
+		Dirs: []string{"conf", "controllers", "models", "routers", "tests", "static", "static/js", "static/css", "static/img", "views"},
+		Files: []starterFile{
+			{"controllers/default.go", controllers},
+			{"views/index.tpl", indextpl},
+			{"routers/router.go", router},
+			{"tests/default_test.go", test},
+			{"main.go", maingo},
+		},
+	},
+	"api": {
+		Name: "api",
+		Conf: apiconf,
+		Dirs: []string{"conf", "controllers", "tests", "models", "routers"},
+		Files: []starterFile{
+			{"controllers/object.go", apiControllers},
+			{"controllers/user.go", apiControllers2},
+			{"tests/default_test.go", apiTests},
+			{"routers/router.go", apirouter},
+			{"models/object.go", apiModels},
+			{"models/user.go", apiModels2},
+			{"main.go", apiMaingo},
+		},
+	},
+	"hprose": {
+		Name: "hprose",
+		Conf: hproseconf,
+		Dirs: []string{"conf", "models"},
+		Files: []starterFile{
+			{"models/object.go", apiModels},
+			{"models/user.go", apiModels2},
+			{"main.go", hproseMaingo},
+		},
+	},
+	"websocket": {
+		Name: "websocket",
+		Conf: appconf,
+		Dirs: []string{"conf", "controllers", "routers", "tests", "static", "static/js", "static/css", "static/img", "views"},
+		Files: []starterFile{
+			{"controllers/default.go", wsControllers},
+			{"controllers/websocket.go", wsWebSocketController},
+			{"views/index.tpl", wsIndextpl},
+			{"routers/router.go", wsRouter},
+			{"tests/default_test.go", test},
+			{"main.go", maingo},
+		},
+	},
+}
+
+var appFeatures = map[string]*appFeature{
+	"orm": {
+		Conf:  "db_driver = {{.Driver}}\ndb_conn = ${DB_CONN||{{.Conn}}}\n",
+		Setup: "setupORM",
+		Dirs:  []string{"models"},
+		Files: []starterFile{{"orm.go", ormgo}},
+	},
+	"session": {
+		Conf: "sessionon = true\nsessionprovider = memory\n",
+	},
+	"i18n": {
+		Conf:  "lang_types = en-US|zh-CN\n",
+		Setup: "setupI18n",
+		Files: []starterFile{
+			{"i18n.go", i18ngo},
+			{"conf/locale_en-US.ini", "hello = Hello\n"},
+			{"conf/locale_zh-CN.ini", "hello = 你好\n"},
+		},
+	},
+	"docker": {
+		Write: writeDockerFeature,
+	},
+}
+
+// findStarter returns the built-in starter name, or reads the starter
+// from the directory name.
+func findStarter(name string, data *AppTemplateData) (*appStarter, error) {
+	if st, ok := appStarters[name]; ok {
+		return st, nil
+	}
+	if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+		return readStarter(name, data)
+	}
+	return nil, fmt.Errorf("unknown template '%s', use one of %s or a directory", name, strings.Join(starterNames(), ", "))
+}
+
+func hasFeature(features []string, name string) bool {
+	for _, f := range features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// driverPkg returns the import registering the database driver.
+func driverPkg(driver string) string {
+	switch driver {
+	case "mysql":
+		return `_ "github.com/go-sql-driver/mysql"`
+	case "postgres":
+		return `_ "github.com/lib/pq"`
+	}
+	return ""
+}
+
+func starterNames() []string {
+	var names []string
+	for name := range appStarters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readStarter reads a starter from dir, laid out like .bee/templates/new:
+// files ending in .tpl are rendered with data and lose the suffix, the
+// others are copied as is. conf/app.conf becomes the Conf of the starter.
+func readStarter(dir string, data *AppTemplateData) (*appStarter, error) {
+	st := new(appStarter)
+	err := filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			st.Dirs = append(st.Dirs, rel)
+			return nil
+		}
+		content, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(rel, ".tpl") {
+			rel = strings.TrimSuffix(rel, ".tpl")
+			t, err := template.New(rel).Funcs(templateFuncs).Parse(string(content))
+			if err != nil {
+				return err
+			}
+			var buf bytes.Buffer
+			if err := t.Execute(&buf, data); err != nil {
+				return err
+			}
+			content = buf.Bytes()
+		}
+		if rel == "conf/app.conf" {
+			st.Conf = string(content)
+			return nil
+		}
+		st.Files = append(st.Files, starterFile{rel, string(content)})
+		return nil
+	})
+	return st, err
+}
+
+// parseFeatures returns the features of a comma separated list.
+func parseFeatures(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := appFeatures[name]; !ok {
+			return nil, fmt.Errorf("unknown feature '%s'", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// writeStarter creates the app at apppath from st, adds the features and
+// writes the config in format.
+func writeStarter(apppath string, st *appStarter, features []string, format string, data *AppTemplateData) {
+	w := NewColorWriter(os.Stdout)
+
+	// func MkdirAll(path string, perm FileMode) error
+	// MkdirAll使用指定的权限和名称创建一个目录，包括任何必要的上级目录，并返回nil，否则返回错误。
+	// 权限位perm会应用在每一个被本函数创建的目录上。如果path指定了一个已经存在的目录，MkdirAll不做任何操作并返回nil。
+	os.MkdirAll(apppath, 0755)
+	// func Fprintf(w io.Writer, format string, a ...interface{}) (n int, err error)
+	// Fprintf根据format参数生成格式化的字符串并写入w。返回写入的字节数和遇到的任何错误。
+
+	// Separator = os.PathSeparator
+	// 操作系统指定的路径分隔符
+	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", apppath+string(filepath.Separator), "\x1b[0m")
+	dirs := append([]string{}, st.Dirs...)
+	for _, name := range features {
+		dirs = append(dirs, appFeatures[name].Dirs...)
+	}
+	for _, dir := range dirs {
+		// func Join(elem ...string) string
+		// Join函数可以将任意数量的路径元素放入一个单一路径里，会根据需要添加路径分隔符。
+		// 结果是经过简化的，所有的空字符串元素会被忽略。
+		dpath := filepath.Join(apppath, filepath.FromSlash(dir))
+		if isExist(dpath) {
+			continue
+		}
+		os.MkdirAll(dpath, 0755)
+		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", dpath+string(filepath.Separator), "\x1b[0m")
+	}
+
+	// func Replace(s, old, new string, n int) string
+	// 返回将s中前n个不重叠old子串都替换为new的新字符串，如果n<0会替换所有old子串。
+	conf := strings.Replace(st.Conf, "{{.Appname}}", data.Appname, -1)
+	if st.Name != "" {
+		conf = templateOr(st.Name+"/conf/app.conf", data, conf)
+	}
+	var setups []string
+	if format != "ini" {
+		setups = append(setups, "setupConfig")
+	}
+	for _, name := range features {
+		f := appFeatures[name]
+		c := strings.Replace(f.Conf, "{{.Driver}}", data.Driver, -1)
+		conf += strings.Replace(c, "{{.Conn}}", data.Conn, -1)
+		if f.Setup != "" {
+			setups = append(setups, f.Setup)
+		}
+	}
+	if conf != "" {
+		content, err := convertConf(conf, format)
+		if err != nil {
+			ColorLog("[ERRO] Could not convert conf/app.conf to %s: %s\n", format, err)
+			os.Exit(2)
+		}
+		fpath := filepath.Join(apppath, "conf", confFileName(format))
+		os.MkdirAll(filepath.Dir(fpath), 0755)
+		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+		WriteToFile(fpath, content)
+	}
+
+	for _, f := range st.Files {
+		content := f.Content
+		if st.Name != "" {
+			content = strings.Replace(content, "{{.Appname}}", data.PkgPath, -1)
+			content = templateOr(st.Name+"/"+f.Path, data, content)
+		}
+		writeStarterFile(apppath, f.Path, content)
+	}
+	if format != "ini" {
+		content := strings.Replace(configgo, "{{.Format}}", format, -1)
+		content = strings.Replace(content, "{{adapterPkg}}", configAdapterPkg(format), -1)
+		writeStarterFile(apppath, "config.go", templateOr("with/config.go", data, content))
+		formatSourceCode(filepath.Join(apppath, "config.go"))
+	}
+	for _, name := range features {
+		for _, f := range appFeatures[name].Files {
+			content := strings.Replace(f.Content, "{{.Appname}}", data.Appname, -1)
+			content = strings.Replace(content, "{{.DriverPkg}}", data.DriverPkg, -1)
+			content = strings.Replace(content, "{{.PkgPath}}", data.PkgPath, -1)
+			writeStarterFile(apppath, f.Path, templateOr("with/"+f.Path, data, content))
+			if strings.HasSuffix(f.Path, ".go") {
+				formatSourceCode(filepath.Join(apppath, filepath.FromSlash(f.Path)))
+			}
+		}
+	}
+	for _, name := range features {
+		if write := appFeatures[name].Write; write != nil {
+			write(apppath, data)
+		}
+	}
+
+	if len(setups) > 0 {
+		addSetupCalls(filepath.Join(apppath, "main.go"), setups)
+	}
+	if format != "ini" {
+		tests, _ := filepath.Glob(filepath.Join(apppath, "tests", "*.go"))
+		for _, fpath := range tests {
+			patchTestConfig(fpath, format)
+		}
+	}
+}
+
+func writeStarterFile(apppath, name, content string) {
+	w := NewColorWriter(os.Stdout)
+	fpath := filepath.Join(apppath, filepath.FromSlash(name))
+	os.MkdirAll(filepath.Dir(fpath), 0755)
+	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+	WriteToFile(fpath, content)
+}
+
+// addSetupCalls makes main in the file fpath call the setup functions of
+// the features first.
+func addSetupCalls(fpath string, setups []string) {
+	src, err := ioutil.ReadFile(fpath)
+	if err != nil || !bytes.Contains(src, []byte("func main() {\n")) {
+		ColorLog("[WARN] Could not find func main, call %s() from it yourself\n", strings.Join(setups, "(), "))
+		return
+	}
+	calls := "func main() {\n"
+	for _, s := range setups {
+		calls += "\t" + s + "()\n"
+	}
+	src = bytes.Replace(src, []byte("func main() {\n"), []byte(calls), 1)
+	if err := ioutil.WriteFile(fpath, src, 0666); err != nil {
+		ColorLog("[WARN] %v\n", err)
+	}
+}
+
+// patchTestConfig makes the test file fpath load conf/app.<format>, since
+// beego.TestBeegoInit only reads conf/app.conf.
+func patchTestConfig(fpath, format string) {
+	src, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return
+	}
+	s := string(src)
+	if !strings.Contains(s, "beego.TestBeegoInit(apppath)") {
+		return
+	}
+	name := "conf/" + confFileName(format)
+	s = strings.Replace(s, "beego.TestBeegoInit(apppath)", `os.Chdir(apppath)
+	if err := beego.LoadAppConfig("`+format+`", "`+name+`"); err != nil {
+		panic(err)
+	}
+	beego.InitBeegoBeforeTest("`+name+`")`, 1)
+	imports := "\"os\"\n\t\"path/filepath\""
+	if pkg := configAdapterPkg(format); pkg != "" {
+		imports += "\n\t" + pkg
+	}
+	s = strings.Replace(s, "\"path/filepath\"", imports, 1)
+	if err := ioutil.WriteFile(fpath, []byte(s), 0666); err != nil {
+		ColorLog("[WARN] %v\n", err)
+	}
+}
+
+// writeDockerFeature writes the files of bee dockerize for the new app,
+// with the database of the orm feature.
+func writeDockerFeature(apppath string, data *AppTemplateData) {
+	d := &DockerTemplateData{
+		Appname:    data.Appname,
+		PkgPath:    data.PkgPath,
+		Port:       appConfValue(apppath, "httpport", "8080"),
+		BuildImage: "golang:1.16",
+		RunImage:   "alpine:3.13",
+	}
+	if data.Driver != "" {
+		if conn, err := composeConn(data.Driver, data.Conn); err == nil {
+			d.Driver, d.Conn = data.Driver, conn
+		}
+	}
+	writeDockerFiles(apppath, d)
+	if !isExist(filepath.Join(apppath, "go.mod")) {
+		ColorLog("[HINT] The Dockerfile builds the app with go modules, run go mod init %s && go mod tidy first\n", data.PkgPath)
+	}
+}
+
+// configAdapterPkg returns the import registering the config adapter of
+// format, the ini and json adapters are part of beego/config.
+func configAdapterPkg(format string) string {
+	if format == "yaml" || format == "xml" {
+		return `_ "github.com/astaxie/beego/config/` + format + `"`
+	}
+	return ""
+}
+
+func confFileName(format string) string {
+	if format == "ini" {
+		return "app.conf"
+	}
+	return "app." + format
+}
+
+// beegoConfKeys gives the keys of the beego settings the case of their
+// field in beego.BConfig. The ini adapter ignores the case of keys, the
+// json and yaml adapters do not.
+var beegoConfKeys = map[string]string{
+	"appname":         "AppName",
+	"httpport":        "HTTPPort",
+	"runmode":         "RunMode",
+	"autorender":      "AutoRender",
+	"copyrequestbody": "CopyRequestBody",
+	"enabledocs":      "EnableDocs",
+	"sessionon":       "SessionOn",
+	"sessionprovider": "SessionProvider",
+}
+
+// convertConf converts the key = value lines of an ini conf to format,
+// which is ini, json or yaml. Sections are only supported in ini.
+func convertConf(ini, format string) (string, error) {
+	if format == "ini" {
+		return ini, nil
+	}
+	var keys, values []string
+	for _, line := range strings.Split(ini, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			return "", fmt.Errorf("section %s is only supported in ini", line)
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return "", fmt.Errorf("invalid line '%s'", line)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if k, ok := beegoConfKeys[strings.ToLower(key)]; ok {
+			key = k
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "json":
+		buf.WriteString("{\n")
+		for i, key := range keys {
+			v := values[i]
+			if !isConfScalar(v) {
+				v = strconv.Quote(v)
+			}
+			buf.WriteString("\t" + strconv.Quote(key) + ": " + v)
+			if i < len(keys)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString("}\n")
+	case "yaml":
+		for i, key := range keys {
+			v := values[i]
+			if !isConfScalar(v) && (v == "" || strings.ContainsAny(v, ":#{}[],&*!|>'\"%@`") || strings.TrimSpace(v) != v) {
+				v = strconv.Quote(v)
+			}
+			buf.WriteString(key + ": " + v + "\n")
+		}
+	default:
+		return "", fmt.Errorf("unknown format %s", format)
+	}
+	return buf.String(), nil
+}
+
+// isConfScalar reports whether v is a number or a boolean, which json and
+// yaml keep unquoted.
+func isConfScalar(v string) bool {
+	if v == "true" || v == "false" {
+		return true
+	}
+	_, err := strconv.ParseInt(v, 10, 64)
+	return err == nil
+}
+
+var configgo = `package main
+
+import (
+	"github.com/astaxie/beego"
+	{{adapterPkg}}
+)
+
+// setupConfig loads conf/app.{{.Format}}, beego only reads conf/app.conf by itself.
+func setupConfig() {
+	if err := beego.LoadAppConfig("{{.Format}}", "conf/app.{{.Format}}"); err != nil {
+		panic(err)
+	}
+}
+`
+
+var ormgo = `package main
+
+import (
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	{{.DriverPkg}}
+)
+
+// setupORM registers the database given by db_driver and db_conn.
+func setupORM() {
+	if err := orm.RegisterDataBase("default", beego.AppConfig.String("db_driver"), beego.AppConfig.String("db_conn")); err != nil {
+		beego.Critical("Could not register the database:", err)
+	}
+}
+`
+
+var i18ngo = `package main
+
+import (
+	"strings"
+
+	"github.com/astaxie/beego"
+	"github.com/beego/i18n"
+)
+
+// setupI18n loads conf/locale_<lang>.ini for the languages of lang_types
+// and adds the i18n function to the views, e.g. {{i18n .Lang "hello"}}.
+func setupI18n() {
+	for _, lang := range strings.Split(beego.AppConfig.String("lang_types"), "|") {
+		if err := i18n.SetMessage(lang, "conf/locale_"+lang+".ini"); err != nil {
+			beego.Error("Could not load locale:", err)
+		}
+	}
+	beego.AddFuncMap("i18n", i18n.Tr)
+}
+`
+
+var wsControllers = `package controllers
+
+import (
+	"github.com/astaxie/beego"
+)
+
+type MainController struct {
+	beego.Controller
+}
+
+func (c *MainController) Get() {
+	c.TplName = "index.tpl"
+}
+`
+
+var wsWebSocketController = `package controllers
+
+import (
+	"github.com/astaxie/beego"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// WebSocketController sends back the messages of a websocket client.
+type WebSocketController struct {
+	beego.Controller
+}
+
+// Get upgrades the connection to a websocket and echoes every message.
+func (c *WebSocketController) Get() {
+	c.EnableRender = false
+	ws, err := upgrader.Upgrade(c.Ctx.ResponseWriter, c.Ctx.Request, nil)
+	if err != nil {
+		beego.Error("Could not upgrade to a websocket:", err)
+		return
+	}
+	defer ws.Close()
+	for {
+		mt, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := ws.WriteMessage(mt, msg); err != nil {
+			return
+		}
+	}
+}
+`
+
+var wsRouter = `package routers
+
+import (
+	"{{.Appname}}/controllers"
+	"github.com/astaxie/beego"
+)
+
+func init() {
+    beego.Router("/", &controllers.MainController{})
+    beego.Router("/ws", &controllers.WebSocketController{})
+}
+`
+
+var wsIndextpl = `<!DOCTYPE html>
+
+<html>
+<head>
+  <title>Beego WebSocket</title>
+  <meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+</head>
+
+<body>
+  <form id="form">
+    <input id="message" type="text" autofocus>
+    <button type="submit">Send</button>
+  </form>
+  <ul id="log"></ul>
+  <script>
+    var ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+    var log = document.getElementById("log");
+    ws.onmessage = function (e) {
+      var li = document.createElement("li");
+      li.textContent = e.data;
+      log.appendChild(li);
+    };
+    document.getElementById("form").onsubmit = function (e) {
+      e.preventDefault();
+      var input = document.getElementById("message");
+      ws.send(input.value);
+      input.value = "";
+    };
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/config"
+	"gopkg.in/yaml.v2"
+)
+
+const iniConf = `appname = blog
+httpport = 8080
+# comment
+sessionon = true
+db_conn = root:@tcp(127.0.0.1:3306)/test
+`
+
+func TestConvertConf(t *testing.T) {
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{"ini", iniConf},
+		{"json", `{
+	"AppName": "blog",
+	"HTTPPort": 8080,
+	"SessionOn": true,
+	"db_conn": "root:@tcp(127.0.0.1:3306)/test"
+}
+`},
+		{"yaml", `AppName: blog
+HTTPPort: 8080
+SessionOn: true
+db_conn: "root:@tcp(127.0.0.1:3306)/test"
+`},
+	}
+	for _, c := range cases {
+		got, err := convertConf(iniConf, c.format)
+		if err != nil {
+			t.Fatalf("%s: %v", c.format, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.format, got, c.want)
+		}
+	}
+
+	if _, err := convertConf("[dev]\nhttpport = 8080\n", "json"); err == nil {
+		t.Error("sections should only be supported in ini")
+	}
+}
+
+func TestOrmDockerConf(t *testing.T) {
+	defer os.Unsetenv("DB_CONN")
+	data := &AppTemplateData{
+		Appname:   "blog",
+		PkgPath:   "blog",
+		Driver:    "mysql",
+		DriverPkg: `_ "github.com/go-sql-driver/mysql"`,
+		Conn:      "root:@tcp(127.0.0.1:3306)/blog",
+	}
+	for _, format := range []string{"ini", "json", "yaml"} {
+		apppath := filepath.Join(t.TempDir(), "blog")
+		writeStarter(apppath, appStarters["api"], []string{"orm", "docker"}, format, data)
+
+		compose, _ := ioutil.ReadFile(filepath.Join(apppath, "docker-compose.yml"))
+		if !strings.Contains(string(compose), `DB_CONN: "root:@tcp(db:3306)/blog"`) {
+			t.Errorf("%s: the compose file does not set DB_CONN:\n%s", format, compose)
+		}
+
+		content, _ := ioutil.ReadFile(filepath.Join(apppath, "conf", confFileName(format)))
+		for _, env := range []string{"", "root:secret@tcp(db:3306)/blog"} {
+			os.Setenv("DB_CONN", env)
+			got := confString(t, format, content, "db_conn")
+			want := env
+			if want == "" {
+				want = data.Conn
+			}
+			if got != want {
+				t.Errorf("%s with DB_CONN=%s: got db_conn %s, want %s", format, env, got, want)
+			}
+		}
+	}
+}
+
+// confString returns the value of key in the config content as beego reads
+// it, environment variables expanded. yaml is read with yaml.v2 since the
+// yaml adapter of beego needs goyaml2.
+func confString(t *testing.T, format string, content []byte, key string) string {
+	if format == "yaml" {
+		m := make(map[string]interface{})
+		if err := yaml.Unmarshal(content, &m); err != nil {
+			t.Fatal(err)
+		}
+		v, _ := config.ExpandValueEnvForMap(m)[key].(string)
+		return v
+	}
+	cnf, err := config.NewConfigData(format, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cnf.String(key)
+}
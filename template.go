@@ -0,0 +1,231 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateDir holds the templates overriding the built-in ones of the
+// generators. bee looks for it in the current directory first, then in the
+// user's home directory. A template is named after what it generates plus
+// ".tpl", e.g. model.go.tpl or new/main.go.tpl, and is rendered with
+// text/template using the data described below.
+const TemplateDir = ".bee/templates"
+
+// templateFuncs are available in every user template.
+var templateFuncs = template.FuncMap{
+	"camelCase":   camelCase,
+	"snakeString": snakeString,
+	"pluralize":   pluralize,
+	"lower":       strings.ToLower,
+	"title":       strings.Title,
+	"join":        strings.Join,
+}
+
+// ModelTemplateData is the data of model.go.tpl, used by
+// bee generate model and bee generate scaffold. query.go.tpl, the Query
+// type shared by the GetAll functions, only gets PackageName.
+type ModelTemplateData struct {
+	PackageName string          // e.g. models
+	ModelName   string          // e.g. Post
+	ModelStruct string          // struct declaration built from -fields
+	ImportTime  bool            // whether the struct has time.Time fields
+	Fields      []TemplateField // the parsed -fields, without the implicit Id
+}
+
+// TemplateField is one entry of -fields, e.g. title:string:64:index:required.
+type TemplateField struct {
+	Name   string // Go field name, e.g. Title
+	Column string // column name, e.g. title
+	Kind   string // type given in -fields, e.g. string
+	Size   string // size given in -fields, e.g. 64
+	Index  string // "index", "unique" or empty
+	Type   string // Go type, e.g. string
+	Valid  string // beego validation rules, e.g. Required;MaxSize(64)
+	Tag    string // struct tag, e.g. `orm:"index;size(64)" valid:"MaxSize(64)"`
+}
+
+// ControllerTemplateData is the data of controller.go.tpl, used by
+// bee generate controller and bee generate scaffold. With -layered,
+// scaffold also renders service.go.tpl with it.
+type ControllerTemplateData struct {
+	PackageName    string // e.g. controllers
+	ControllerName string // e.g. Post
+	PkgPath        string // import path of the app, set when HasModel is
+	HasModel       bool   // whether models/<name>.go exists
+	HasService     bool   // whether services/<name>.go exists, -layered only
+}
+
+// ViewTemplateData is the data of view/index.tpl, view/show.tpl,
+// view/create.tpl and view/edit.tpl, used by bee generate view and bee
+// generate scaffold. The output is a beego template itself, so its actions
+// must be escaped, e.g. {{"{{"}}range .list{{"}}"}}. When the model exists,
+// view/controller.go.tpl renders the controller of the pages with it too.
+type ViewTemplateData struct {
+	ViewPath  string          // e.g. admin/post
+	URL       string          // URL of the pages, e.g. /admin/post
+	ModelName string          // e.g. Post
+	PkName    string          // primary key field, e.g. Id
+	Fields    []TemplateField // from -fields or the model struct, may be empty
+}
+
+// TestTemplateData is the data of controller_test.go.tpl, used by bee
+// generate controller and bee generate scaffold, and of
+// appcode/controller_test.go.tpl.
+type TestTemplateData struct {
+	ControllerName string // e.g. Post for PostController
+	PkgPath        string // import path of the app
+	URL            string // URL of the controller, e.g. /v1/post
+	PkName         string // primary key field of the model, e.g. Id
+	Body           string // sample JSON body for Post and Put
+}
+
+// MigrationTemplateData is the data of migration.go.tpl, used by
+// bee generate migration and bee generate scaffold.
+type MigrationTemplateData struct {
+	StructName string // e.g. Post_20160102_150405
+	CurrTime   string // e.g. 20160102_150405
+	UpSQL      string // Go statements creating the table, may be empty
+	DownSQL    string // Go statements dropping the table, may be empty
+}
+
+// AppcodeTemplateData is the data of the per table templates of
+// bee generate appcode and bee hprose:
+//   appcode/model.go.tpl             model of a table with a primary key
+//   appcode/struct.go.tpl            model of a table without primary key
+//   appcode/controller.go.tpl        controller of a table with a primary key
+//   appcode/model_user.go.tpl        user-owned model file, created once
+//   appcode/controller_user.go.tpl   user-owned controller file, created once
+//   appcode/hprose_model.go.tpl      hprose model of a table with a primary key
+//   appcode/hprose_struct.go.tpl     hprose model of a table without primary key
+//   appcode/hprose_function.go.tpl   service.AddFunction calls in the hprose main.go
+//   appcode/grpc.proto.tpl           proto file of a table with -transport=grpc
+//   appcode/grpc_server.go.tpl       grpc server of a table with -transport=grpc
+type AppcodeTemplateData struct {
+	ModelName   string // e.g. UserRole
+	TableName   string // e.g. tbl_user_role
+	FileName    string // e.g. user_role
+	ModelStruct string // struct declaration with orm tags
+	ImportTime  bool   // whether the struct has time.Time fields
+	PkgPath     string // import path of the app
+	Table       *Table // table, columns and foreign keys read from the database
+	// ProtoFields are the fields of the proto message, with -transport=grpc
+	ProtoFields []ProtoField
+}
+
+// GrpcTemplateData is the data of appcode/grpc_register.go.tpl and
+// appcode/grpc_pb.go.tpl, written with -transport=grpc.
+type GrpcTemplateData struct {
+	PkgPath    string   // import path of the app
+	Services   []string // model names of the registered servers, e.g. UserRole
+	ProtoFiles []string // proto files compiled by go generate, relative to pb
+}
+
+// RouterTemplateData is the data of appcode/router.go.tpl. Keep the
+// "bee:generated begin" and "bee:generated end" comments around the
+// namespaces so that later runs can update them. Each namespace is
+// rendered with appcode/namespace.go.tpl, which gets a RouterNamespace.
+type RouterTemplateData struct {
+	PkgPath    string // import path of the app
+	Namespaces string // rendered namespaces
+}
+
+// RouterNamespace is the data of appcode/namespace.go.tpl.
+type RouterNamespace struct {
+	Name     string // URL segment, the table name
+	CtrlName string // e.g. UserRole for controllers.UserRoleController
+}
+
+// AppTemplateData is the data of the application skeletons of bee new,
+// bee api and bee hprose. There is one template per file, named after the
+// command and the file, e.g. new/main.go.tpl, api/routers/router.go.tpl or
+// hprose/conf/app.conf.tpl. bee new -template=websocket uses websocket/,
+// and the files of the -with features use with/, e.g. with/orm.go.tpl.
+// Views using beego template actions must escape them, e.g.
+// {{"{{"}}.Website{{"}}"}}.
+type AppTemplateData struct {
+	Appname         string   // e.g. blog
+	PkgPath         string   // e.g. github.com/me/blog
+	Driver          string   // database driver, with -conn or -with=orm only
+	DriverPkg       string   // import of the driver, with -conn or -with=orm only
+	Conn            string   // connection string, with -conn or -with=orm only
+	HproseFunctions string   // rendered service.AddFunction calls, hprose only
+	Template        string   // -template of bee new, e.g. web
+	Features        []string // -with of bee new, e.g. orm, session
+	Config          string   // -config of bee new: ini, json or yaml
+}
+
+// findTemplate returns the path of the user template name, or an empty
+// string if there is none.
+func findTemplate(name string) string {
+	var dirs []string
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, filepath.Join(wd, TemplateDir))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, TemplateDir))
+	}
+	for _, dir := range dirs {
+		fpath := filepath.Join(dir, filepath.FromSlash(name)+".tpl")
+		if isExist(fpath) {
+			return fpath
+		}
+	}
+	return ""
+}
+
+// renderTemplate renders the user template name with data. It reports
+// false if there is no such template and the built-in one should be used.
+func renderTemplate(name string, data interface{}) (string, bool) {
+	fpath := findTemplate(name)
+	if fpath == "" {
+		return "", false
+	}
+	Debugf("Using template %s", fpath)
+	content, err := executeTemplate(fpath, data)
+	if err != nil {
+		ColorLog("[ERRO] %s\n", err)
+		os.Exit(2)
+	}
+	return content, true
+}
+
+// executeTemplate parses the template file fpath and renders it with data.
+func executeTemplate(fpath string, data interface{}) (string, error) {
+	t, err := template.New(filepath.Base(fpath)).Funcs(templateFuncs).ParseFiles(fpath)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse template: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Could not render template: %s", err)
+	}
+	return buf.String(), nil
+}
+
+// templateOr renders the user template name with data, or returns
+// builtin if there is no such template.
+func templateOr(name string, data interface{}, builtin string) string {
+	if content, ok := renderTemplate(name, data); ok {
+		return content
+	}
+	return builtin
+}
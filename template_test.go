@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inTemplateDir runs f in a temporary app directory whose .bee/templates
+// holds files, with a home directory without templates.
+func inTemplateDir(t *testing.T, files map[string]string, f func(dir string)) {
+	dir := t.TempDir()
+	for name, content := range files {
+		fpath := filepath.Join(dir, TemplateDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(fpath), 0755)
+		ioutil.WriteFile(fpath, []byte(content), 0644)
+	}
+	t.Setenv("HOME", t.TempDir())
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+	f(dir)
+}
+
+func TestTemplateOr(t *testing.T) {
+	files := map[string]string{
+		"model.go.tpl":          "package {{.PackageName}} // {{.ModelName}}\n",
+		"appcode/router.go.tpl": "{{.PkgPath}}\n",
+	}
+	inTemplateDir(t, files, func(dir string) {
+		if got, want := findTemplate("appcode/router.go"), filepath.Join(dir, TemplateDir, "appcode", "router.go.tpl"); got != want {
+			t.Errorf("findTemplate: got %s, want %s", got, want)
+		}
+		if got := findTemplate("controller.go"); got != "" {
+			t.Errorf("findTemplate: got %s for a missing template", got)
+		}
+
+		data := &ModelTemplateData{PackageName: "models", ModelName: "Post"}
+		if got := templateOr("model.go", data, "builtin"); got != "package models // Post\n" {
+			t.Errorf("override: got %q", got)
+		}
+		if got := templateOr("controller.go", data, "builtin"); got != "builtin" {
+			t.Errorf("fallback: got %q", got)
+		}
+	})
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	files := map[string]string{
+		"parse.go.tpl":  "{{.ModelName",
+		"render.go.tpl": "{{.Missing}}",
+	}
+	inTemplateDir(t, files, func(dir string) {
+		for name, want := range map[string]string{"parse.go": "Could not parse template", "render.go": "Could not render template"} {
+			_, err := executeTemplate(findTemplate(name), &ModelTemplateData{})
+			if err == nil || !strings.HasPrefix(err.Error(), want) {
+				t.Errorf("%s: got %v, want %s", name, err, want)
+			}
+		}
+	})
+}
@@ -32,6 +32,7 @@ var (
 	state        sync.Mutex
 	eventTime    = make(map[string]int64)
 	scheduleTime time.Time
+	runBuildInfo *buildInfo // read once per bee run, set in every build
 )
 
 func NewWatcher(paths []string, files []string, isgenerate bool) {
@@ -176,6 +177,9 @@ func Autobuild(files []string, isgenerate bool) {
 		if buildTags != "" {
 			args = append(args, "-tags", buildTags)
 		}
+		if runBuildInfo != nil {
+			args = withLdflags(args, runBuildInfo.ldflags(conf.BuildInfo.Package))
+		}
 		args = append(args, files...)
 
 		bcmd := exec.Command(cmdName, args...)